@@ -27,7 +27,6 @@ gen: generate-config fmt mirror-licenses
 gen-check: gen check-clean-repo
 
 generate-config:
-	@rm -fr prow/cluster/jobs/istio/*/*.gen.yaml
 	@(cd prow/config/cmd; go run generate.go write)
 	@rm -fr prow/cluster/jobs/istio-private/*/*.gen.yaml
 	@go run prow/genjobs/main.go --configs=./prow/config/istio-private_jobs
@@ -35,4 +34,7 @@ generate-config:
 diff-config:
 	@(cd prow/config/cmd; GOARCH=$(GOARCH) GOOS=$(GOOS) go run generate.go diff)
 
+check-config:
+	@(cd prow/config/cmd; GOARCH=$(GOARCH) GOOS=$(GOOS) go run generate.go check)
+
 include common/Makefile.common.mk
@@ -0,0 +1,432 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+
+	"istio.io/test-infra/prow/genjobs/pkg/configuration"
+)
+
+// imageSourceBranch is the branch the tags of the images of the branched meta configs start
+// with, e.g. gcr.io/istio-testing/build-tools:master-2021-07-14T19-43-48.
+const imageSourceBranch = "master"
+
+var versionRegex = regexp.MustCompile(`^([0-9]+)\.([0-9]+)$`)
+
+// BranchOptions configures the files a release branch is created in.
+type BranchOptions struct {
+	// Version is the release version, e.g. 1.12 for the release-1.12 branch.
+	Version string
+	// MetaConfigDir is the directory the branched meta configs are written to.
+	MetaConfigDir string
+	// TransformConfigDir is the directory of the private transform configs. They are not branched
+	// if it is empty.
+	TransformConfigDir string
+	// ProwConfig is the Prow config file the branch protection is added to. The branch protection
+	// is not changed if it is empty.
+	ProwConfig string
+	// PinDigests makes the branched meta configs refer to their images by digest as well as by
+	// tag. The images already pinned to a digest stay pinned.
+	PinDigests bool
+}
+
+// BranchPlan lists the changes creating a release branch.
+type BranchPlan struct {
+	Version string
+	Branch  string
+	// Images are the images tagged for the branch.
+	Images []ImageTag
+	// MetaConfigs are the branched meta configs.
+	MetaConfigs []BranchedMetaConfig
+	// TransformConfigs are the branched private transform configs.
+	TransformConfigs []BranchedTransformConfig
+	// ProwConfig is the Prow config file the branch protection is added to, with its new content.
+	// It is empty if the branch protection is unchanged.
+	ProwConfig        string
+	ProwConfigContent []byte
+	// ProtectedFrom is the release branch the protection of the branch is copied from.
+	ProtectedFrom string
+}
+
+// ImageTag is the tag of an image for a branch.
+type ImageTag struct {
+	Source string
+	Target string
+	// Digest is the digest of the source image, if known.
+	Digest string
+	// Pin is set if the branched meta configs refer to the target image by its digest.
+	Pin bool
+}
+
+// pinned returns the target image pinned to the digest.
+func (t ImageTag) pinned() string {
+	return t.Target + "@" + t.Digest
+}
+
+// BranchedMetaConfig is a meta config branched from the meta config in Source.
+type BranchedMetaConfig struct {
+	Source     string
+	Path       string
+	JobsConfig JobsConfig
+}
+
+// BranchedTransformConfig is a private transform config branched from the one in Source.
+type BranchedTransformConfig struct {
+	Source string
+	Path   string
+	Config configuration.Configuration
+}
+
+// PlanBranch returns the changes creating the release branch of the options. The meta configs and
+// transform configs supporting release branching are copied for the branch, and the branch
+// protection of the latest release branch is copied for the new branch. The images tagged with the
+// master branch, as `master` or `master-<suffix>`, are tagged for the branch by replacing it with
+// the release branch, e.g. build-tools:master-2021-07-14T19-43-48 is tagged as
+// build-tools:release-1.12-2021-07-14T19-43-48.
+func (cli *Client) PlanBranch(o BranchOptions, metaConfigs []MetaConfig) (*BranchPlan, error) {
+	if !versionRegex.MatchString(o.Version) {
+		return nil, fmt.Errorf("invalid release version %q, must be of the form <major>.<minor>", o.Version)
+	}
+	p := &BranchPlan{Version: o.Version, Branch: "release-" + o.Version}
+
+	tagged := map[string]bool{}
+	for _, mc := range metaConfigs {
+		jobs := mc.JobsConfig
+		if !jobs.SupportReleaseBranching {
+			continue
+		}
+		jobs.Jobs = FilterReleaseBranchingJobs(jobs.Jobs)
+
+		if jobs.Image != "" {
+			t, ok, err := branchImage(jobs.Image, p.Branch, o.PinDigests)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", mc.Path, err)
+			}
+			if ok {
+				if !tagged[t.Target] {
+					p.Images = append(p.Images, t)
+					tagged[t.Target] = true
+				}
+				jobs.Image = t.Target
+				if t.Digest != "" {
+					jobs.Image = t.pinned()
+				}
+			}
+		}
+		jobs.Branches = []string{p.Branch}
+		jobs.SupportReleaseBranching = false
+
+		p.MetaConfigs = append(p.MetaConfigs, BranchedMetaConfig{
+			Source:     mc.Path,
+			Path:       filepath.Join(o.MetaConfigDir, branchedFileName(mc.Path, o.Version)),
+			JobsConfig: jobs,
+		})
+	}
+
+	if o.TransformConfigDir != "" {
+		err := filepath.Walk(o.TransformConfigDir, func(src string, file os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if file.IsDir() || !IsMetaConfigFile(file.Name()) {
+				return nil
+			}
+			c, err := configuration.ReadTransformJobsConfig(src)
+			if err != nil {
+				return err
+			}
+			if !c.SupportReleaseBranching {
+				return nil
+			}
+			p.TransformConfigs = append(p.TransformConfigs, BranchedTransformConfig{
+				Source: src,
+				Path:   filepath.Join(filepath.Dir(src), branchedFileName(src, o.Version)),
+				Config: configuration.BranchTransformJobsConfig(c, o.Version),
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("walking through the transform config files failed: %v", err)
+		}
+	}
+
+	if o.ProwConfig != "" {
+		content, err := ioutil.ReadFile(o.ProwConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", o.ProwConfig, err)
+		}
+		newContent, from, err := addBranchProtection(string(content), o.Version)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", o.ProwConfig, err)
+		}
+		if from != "" {
+			p.ProwConfig = o.ProwConfig
+			p.ProwConfigContent = []byte(newContent)
+			p.ProtectedFrom = from
+		}
+	}
+
+	if err := cli.validateBranchPlan(p, o, metaConfigs); err != nil {
+		return nil, fmt.Errorf("the branched meta configs are invalid: %v", err)
+	}
+	return p, nil
+}
+
+// validateBranchPlan validates the branched meta configs before anything is applied. They are
+// validated on their own, and with the other meta configs through the Prow validation if the
+// options have a Prow config, using its content with the branch protection of the plan.
+func (cli *Client) validateBranchPlan(p *BranchPlan, o BranchOptions, metaConfigs []MetaConfig) error {
+	var err *multierror.Error
+	planned := map[string]bool{}
+	var branched []MetaConfig
+	for _, mc := range p.MetaConfigs {
+		err = multierror.Append(err, cli.ValidateJobConfig(filepath.Base(mc.Path), mc.JobsConfig))
+		planned[filepath.Clean(mc.Path)] = true
+		branched = append(branched, MetaConfig{Path: mc.Path, JobsConfig: mc.JobsConfig})
+	}
+	if err.ErrorOrNil() != nil || o.ProwConfig == "" {
+		return err.ErrorOrNil()
+	}
+
+	// The meta configs overwritten by the plan are replaced by the branched ones.
+	all := branched
+	for _, mc := range metaConfigs {
+		if !planned[filepath.Clean(mc.Path)] {
+			all = append(all, mc)
+		}
+	}
+	prowConfig := o.ProwConfig
+	if p.ProwConfig != "" {
+		f, e := ioutil.TempFile("", "prow-config-*.yaml")
+		if e != nil {
+			return e
+		}
+		defer os.Remove(f.Name())
+		_, e = f.Write(p.ProwConfigContent)
+		if ce := f.Close(); e == nil {
+			e = ce
+		}
+		if e != nil {
+			return e
+		}
+		prowConfig = f.Name()
+	}
+	return cli.ValidateProwConfig(prowConfig, all)
+}
+
+// Apply tags the images and writes the branched files. The images are tagged first, so that no
+// file is changed if the registry cannot be updated. The digests of the pinned images not known
+// yet are resolved with the registry.
+func (p *BranchPlan) Apply(registry Registry) error {
+	pinned := map[string]string{}
+	for i := range p.Images {
+		t := &p.Images[i]
+		if t.Pin && t.Digest == "" {
+			digest, err := registry.Digest(t.Source)
+			if err != nil {
+				return err
+			}
+			t.Digest = digest
+		}
+		if err := registry.Tag(t.Source, t.Target); err != nil {
+			return err
+		}
+		if t.Pin {
+			pinned[t.Target] = t.pinned()
+		}
+	}
+	for i := range p.MetaConfigs {
+		mc := &p.MetaConfigs[i]
+		if image, ok := pinned[mc.JobsConfig.Image]; ok {
+			mc.JobsConfig.Image = image
+		}
+	}
+	for _, mc := range p.MetaConfigs {
+		if err := WriteJobConfig(mc.JobsConfig, mc.Path); err != nil {
+			return fmt.Errorf("writing branched config %s failed: %v", mc.Path, err)
+		}
+	}
+	for _, tc := range p.TransformConfigs {
+		if err := configuration.WriteTransformJobConfig(tc.Config, tc.Path); err != nil {
+			return fmt.Errorf("writing branched transform config %s failed: %v", tc.Path, err)
+		}
+	}
+	if p.ProwConfig != "" {
+		if err := ioutil.WriteFile(p.ProwConfig, p.ProwConfigContent, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %v", p.ProwConfig, err)
+		}
+	}
+	return nil
+}
+
+// Write writes the plan in a human readable form.
+func (p *BranchPlan) Write(w io.Writer) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Creating the %s branch:\n", p.Branch)
+	for _, t := range p.Images {
+		fmt.Fprintf(&sb, "- tag image %s as %s", t.Source, t.Target)
+		if t.Pin {
+			sb.WriteString(", pinned to its digest")
+		}
+		sb.WriteString("\n")
+	}
+	for _, mc := range p.MetaConfigs {
+		fmt.Fprintf(&sb, "- write meta config %s from %s\n", mc.Path, mc.Source)
+	}
+	for _, tc := range p.TransformConfigs {
+		fmt.Fprintf(&sb, "- write transform config %s from %s\n", tc.Path, tc.Source)
+	}
+	if p.ProwConfig != "" {
+		fmt.Fprintf(&sb, "- add the branch protection of %s to %s, copied from %s\n", p.Branch, p.ProwConfig, p.ProtectedFrom)
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// branchImage returns the tag of the image for the branch, if the image is tagged with the master
+// branch. The image is tagged by digest if it is pinned to one.
+func branchImage(image, branch string, pin bool) (ImageTag, bool, error) {
+	ref, err := parseImage(image)
+	if err != nil {
+		return ImageTag{}, false, fmt.Errorf("invalid image %s: %v", image, err)
+	}
+	if ref.Tag != imageSourceBranch && !strings.HasPrefix(ref.Tag, imageSourceBranch+"-") {
+		return ImageTag{}, false, nil
+	}
+	target := imageRef{Repository: ref.Repository, Tag: branch + strings.TrimPrefix(ref.Tag, imageSourceBranch)}
+	return ImageTag{
+		Source: image,
+		Target: target.String(),
+		Digest: ref.Digest,
+		Pin:    pin || ref.Digest != "",
+	}, true, nil
+}
+
+// branchedFileName returns the name of the file branched for the version from the file, e.g.
+// istio-1.12.yaml for istio.yaml.
+func branchedFileName(file, version string) string {
+	name := filepath.Base(file)
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext) + "-" + version + ext
+}
+
+// addBranchProtection copies the branch protection of the latest release branch before the
+// version in the branch-protection section of the Prow config, for the release branch of the
+// version. The config is edited as text to keep its comments and yaml anchors. Each entry of the
+// latest release branch is copied after it, with only the branch key, the anchors and aliases of
+// the release branch and its release managers team replaced, e.g. `release-1.11: &release111` is
+// copied to `release-1.12: &release112`, `<<: *release111` to `<<: *release112` and
+// `release-managers-1.11` to `release-managers-1.12`. The other settings are copied as is. It
+// returns the release branch copied from, which is empty if the version is already protected.
+func addBranchProtection(content, version string) (string, string, error) {
+	lines := strings.Split(content, "\n")
+	start, end := protectionSection(lines)
+	if start < 0 {
+		return "", "", fmt.Errorf("no branch-protection section")
+	}
+
+	branchRegex := regexp.MustCompile(`^\s*release-([0-9]+\.[0-9]+):`)
+	prev := ""
+	for _, l := range lines[start:end] {
+		m := branchRegex.FindStringSubmatch(l)
+		if m == nil {
+			continue
+		}
+		if m[1] == version {
+			return content, "", nil
+		}
+		if versionLess(m[1], version) && (prev == "" || versionLess(prev, m[1])) {
+			prev = m[1]
+		}
+	}
+	if prev == "" {
+		return "", "", fmt.Errorf("no release branch before release-%s to copy the branch protection from", version)
+	}
+
+	anchorRegex := regexp.MustCompile(`([&*])release` + strings.ReplaceAll(prev, ".", "") + `\b`)
+	anchor := "${1}release" + strings.ReplaceAll(version, ".", "")
+	teamRegex := regexp.MustCompile(`\brelease-managers-` + regexp.QuoteMeta(prev) + `\b`)
+	team := "release-managers-" + version
+	res := append([]string{}, lines[:start]...)
+	for i := start; i < end; i++ {
+		res = append(res, lines[i])
+		m := branchRegex.FindStringSubmatch(lines[i])
+		if m == nil || m[1] != prev {
+			continue
+		}
+		// The entry lasts until the next line indented as much as it, or less.
+		indent := countIndent(lines[i])
+		block := []string{lines[i]}
+		for j := i + 1; j < end && strings.TrimSpace(lines[j]) != "" && countIndent(lines[j]) > indent; j++ {
+			block = append(block, lines[j])
+		}
+		res = append(res, block[1:]...)
+		block[0] = strings.Replace(block[0], "release-"+prev+":", "release-"+version+":", 1)
+		for _, l := range block {
+			res = append(res, teamRegex.ReplaceAllString(anchorRegex.ReplaceAllString(l, anchor), team))
+		}
+		i += len(block) - 1
+	}
+	res = append(res, lines[end:]...)
+	return strings.Join(res, "\n"), "release-" + prev, nil
+}
+
+// protectionSection returns the lines of the top level branch-protection section, or -1 if there
+// is none.
+func protectionSection(lines []string) (int, int) {
+	start := -1
+	for i, l := range lines {
+		if start < 0 {
+			if strings.HasPrefix(l, "branch-protection:") {
+				start = i
+			}
+			continue
+		}
+		if l != "" && countIndent(l) == 0 && !strings.HasPrefix(l, "#") {
+			return start, i
+		}
+	}
+	return start, len(lines)
+}
+
+func countIndent(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// versionLess returns whether the <major>.<minor> version a is before b.
+func versionLess(a, b string) bool {
+	am, bm := versionRegex.FindStringSubmatch(a), versionRegex.FindStringSubmatch(b)
+	if am == nil || bm == nil {
+		return a < b
+	}
+	for i := 1; i <= 2; i++ {
+		an, _ := strconv.Atoi(am[i])
+		bn, _ := strconv.Atoi(bm[i])
+		if an != bn {
+			return an < bn
+		}
+	}
+	return false
+}
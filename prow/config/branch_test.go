@@ -0,0 +1,392 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"istio.io/test-infra/prow/genjobs/pkg/configuration"
+)
+
+const branchProwConfig = `branch-protection:
+  orgs:
+    istio:
+      repos:
+        api:
+          branches: &blocked_branches
+            master:
+              protect: true
+            release-1.9: &release19
+              protect: true
+              restrictions:
+                teams:
+                - release-managers-1.9
+            release-1.10: &release110
+              protect: true
+              restrictions:
+                teams:
+                - release-managers-1.10
+        istio:
+          branches:
+            <<: *blocked_branches
+            release-1.10:
+              <<: *release110
+              # Only the key, anchors, aliases and release managers of release-1.10 are replaced.
+              required_status_checks:
+                contexts:
+                - "merges-blocked-1.10"
+tide:
+  queries:
+  - repos:
+    - istio/istio
+plank:
+  default_decoration_configs:
+    '*':
+      utility_images:
+        clonerefs: gcr.io/k8s-prow/clonerefs:v20210720-5548472063
+        initupload: gcr.io/k8s-prow/initupload:v20210720-5548472063
+        entrypoint: gcr.io/k8s-prow/entrypoint:v20210720-5548472063
+        sidecar: gcr.io/k8s-prow/sidecar:v20210720-5548472063
+      gcs_configuration:
+        bucket: istio-prow
+        path_strategy: explicit
+`
+
+const branchedProwConfig = `branch-protection:
+  orgs:
+    istio:
+      repos:
+        api:
+          branches: &blocked_branches
+            master:
+              protect: true
+            release-1.9: &release19
+              protect: true
+              restrictions:
+                teams:
+                - release-managers-1.9
+            release-1.10: &release110
+              protect: true
+              restrictions:
+                teams:
+                - release-managers-1.10
+            release-1.11: &release111
+              protect: true
+              restrictions:
+                teams:
+                - release-managers-1.11
+        istio:
+          branches:
+            <<: *blocked_branches
+            release-1.10:
+              <<: *release110
+              # Only the key, anchors, aliases and release managers of release-1.10 are replaced.
+              required_status_checks:
+                contexts:
+                - "merges-blocked-1.10"
+            release-1.11:
+              <<: *release111
+              # Only the key, anchors, aliases and release managers of release-1.10 are replaced.
+              required_status_checks:
+                contexts:
+                - "merges-blocked-1.10"
+tide:
+  queries:
+  - repos:
+    - istio/istio
+plank:
+  default_decoration_configs:
+    '*':
+      utility_images:
+        clonerefs: gcr.io/k8s-prow/clonerefs:v20210720-5548472063
+        initupload: gcr.io/k8s-prow/initupload:v20210720-5548472063
+        entrypoint: gcr.io/k8s-prow/entrypoint:v20210720-5548472063
+        sidecar: gcr.io/k8s-prow/sidecar:v20210720-5548472063
+      gcs_configuration:
+        bucket: istio-prow
+        path_strategy: explicit
+`
+
+func TestBranch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "branch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	host, stop := startRegistry()
+	defer stop()
+	image := host + "/istio-testing/build-tools:master-2021-07-14T19-43-48"
+	proxyImage := host + "/istio-testing/proxy:master"
+	proxyDigest := pushImage(t, proxyImage)
+	write("jobs/istio.yaml", fmt.Sprintf(`org: istio
+repo: istio
+support_release_branching: true
+image: %s
+jobs:
+- name: unit-tests
+  command: [make, test]
+- name: release-notes
+  command: [make, release-notes]
+  disable_release_branching: true
+`, image))
+	write("jobs/proxy.yaml", fmt.Sprintf(`org: istio
+repo: proxy
+support_release_branching: true
+image: %s@%s
+jobs:
+- name: unit-tests
+  command: [make, test]
+`, proxyImage, proxyDigest))
+	write("jobs/bots.yaml", `org: istio
+repo: bots
+image: gcr.io/istio-testing/build-tools:master-2021-07-14T19-43-48
+jobs:
+- name: unit-tests
+  command: [make, test]
+`)
+	write("private/istio.yaml", `org: istio
+repo: istio
+support_release_branching: true
+defaults:
+  branches: [master]
+  modifier: master_priv
+transforms:
+- job-allowlist: [unit-tests, release_postsubmit]
+  labels:
+    preset-branch: master
+`)
+	prowConfig := write("config.yaml", branchProwConfig)
+
+	cli := &Client{}
+	metaConfigs, err := cli.ReadJobsConfigs(filepath.Join(dir, "jobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := cli.PlanBranch(BranchOptions{
+		Version:            "1.11",
+		MetaConfigDir:      filepath.Join(dir, "jobs"),
+		TransformConfigDir: filepath.Join(dir, "private"),
+		ProwConfig:         prowConfig,
+	}, metaConfigs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	branchedMeta := filepath.Join(dir, "jobs/istio-1.11.yaml")
+	if _, err := os.Stat(branchedMeta); !os.IsNotExist(err) {
+		t.Fatalf("the plan must not write the branched files, got %v", err)
+	}
+
+	// The files are not written if the images cannot be tagged, the image is not pushed yet.
+	if err := plan.Apply(NewOCIRegistry()); err == nil {
+		t.Fatal("expected an error for the missing image")
+	}
+	if _, err := os.Stat(branchedMeta); !os.IsNotExist(err) {
+		t.Fatalf("the branched files must not be written if the tagging fails, got %v", err)
+	}
+
+	digest := pushImage(t, image)
+	if err := plan.Apply(NewOCIRegistry()); err != nil {
+		t.Fatal(err)
+	}
+	branchedImage := host + "/istio-testing/build-tools:release-1.11-2021-07-14T19-43-48"
+	branchedProxyImage := host + "/istio-testing/proxy:release-1.11"
+	for img, expected := range map[string]string{branchedImage: digest, branchedProxyImage: proxyDigest} {
+		if actual, err := NewOCIRegistry().Digest(img); err != nil || actual != expected {
+			t.Errorf("image %s is not tagged; actual digest: %s, %v\n expected %s\n", img, actual, err, expected)
+		}
+	}
+
+	branched, err := cli.ReadJobsConfig(branchedMeta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if branched.SupportReleaseBranching || !reflect.DeepEqual(branched.Branches, []string{"release-1.11"}) ||
+		branched.Image != branchedImage ||
+		len(branched.Jobs) != 1 || branched.Jobs[0].Name != "unit-tests" {
+		t.Errorf("unexpected branched meta config %+v", branched)
+	}
+	proxy, err := cli.ReadJobsConfig(filepath.Join(dir, "jobs/proxy-1.11.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proxy.Image != branchedProxyImage+"@"+proxyDigest {
+		t.Errorf("the branched image must stay pinned; actual: %s\n expected %s\n", proxy.Image, branchedProxyImage+"@"+proxyDigest)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "jobs/bots-1.11.yaml")); !os.IsNotExist(err) {
+		t.Errorf("meta config not supporting release branching must not be branched, got %v", err)
+	}
+
+	transform, err := configuration.ReadTransformJobsConfig(filepath.Join(dir, "private/istio-1.11.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedTransform := configuration.Configuration{
+		Org:  "istio",
+		Repo: "istio",
+		Defaults: configuration.Transform{
+			Branches: []string{"release-1.11"},
+			Modifier: "release-1.11_priv",
+		},
+		Transforms: []configuration.Transform{{
+			JobAllowlist: []string{"unit-tests_release-1.11", "release_release-1.11_postsubmit"},
+			Labels:       map[string]string{"preset-branch": "release-1.11"},
+		}},
+	}
+	if !reflect.DeepEqual(expectedTransform, transform) {
+		t.Errorf("branched transform config does not match; actual: %+v\n expected %+v\n", transform, expectedTransform)
+	}
+
+	content, err := ioutil.ReadFile(prowConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != branchedProwConfig {
+		t.Errorf("branch protection does not match; actual:\n%s\nexpected:\n%s", content, branchedProwConfig)
+	}
+
+	// The branch protection is only added once.
+	if _, from, err := addBranchProtection(string(content), "1.11"); err != nil || from != "" {
+		t.Errorf("expected the protected branch to be left alone, got %q, %v", from, err)
+	}
+	if _, err := cli.PlanBranch(BranchOptions{Version: "next"}, metaConfigs); err == nil {
+		t.Error("expected an error for an invalid version")
+	}
+}
+
+func TestPlanBranchValidation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "branch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	meta := filepath.Join(dir, "istio.yaml")
+	// The postsubmit name only gets too long with the release branch.
+	if err := ioutil.WriteFile(meta, []byte(`org: istio
+repo: istio
+support_release_branching: true
+image: gcr.io/istio-testing/build-tools:master-2021-07-14T19-43-48
+jobs:
+- name: integ-security-istiodless-multicluster-tests
+  command: [make, test]
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cli := &Client{}
+	metaConfigs, err := cli.ReadJobsConfigs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cli.PlanBranch(BranchOptions{Version: "1.12", MetaConfigDir: dir}, metaConfigs)
+	expected := "integ-security-istiodless-multicluster-tests_istio_release-1.12_postsubmit is longer than 63 characters"
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("expected an error containing %q, got %v", expected, err)
+	}
+}
+
+func TestBranchImage(t *testing.T) {
+	const digest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	testCases := []struct {
+		name     string
+		image    string
+		pin      bool
+		expected *ImageTag
+	}{
+		{
+			name:  "timestamp",
+			image: "gcr.io/istio-testing/build-tools:master-2021-07-14T19-43-48",
+			expected: &ImageTag{
+				Source: "gcr.io/istio-testing/build-tools:master-2021-07-14T19-43-48",
+				Target: "gcr.io/istio-testing/build-tools:release-1.12-2021-07-14T19-43-48",
+			},
+		},
+		{
+			name:  "branch only",
+			image: "localhost:5000/build-tools:master",
+			expected: &ImageTag{
+				Source: "localhost:5000/build-tools:master",
+				Target: "localhost:5000/build-tools:release-1.12",
+			},
+		},
+		{
+			name:  "pinned",
+			image: "gcr.io/istio-testing/build-tools:master-abc@" + digest,
+			expected: &ImageTag{
+				Source: "gcr.io/istio-testing/build-tools:master-abc@" + digest,
+				Target: "gcr.io/istio-testing/build-tools:release-1.12-abc",
+				Digest: digest,
+				Pin:    true,
+			},
+		},
+		{
+			name:  "pin",
+			image: "gcr.io/istio-testing/build-tools:master-abc",
+			pin:   true,
+			expected: &ImageTag{
+				Source: "gcr.io/istio-testing/build-tools:master-abc",
+				Target: "gcr.io/istio-testing/build-tools:release-1.12-abc",
+				Pin:    true,
+			},
+		},
+		{
+			name:  "other tag",
+			image: "gcr.io/istio-testing/build-tools:latest",
+		},
+		{
+			name:  "other branch",
+			image: "gcr.io/istio-testing/build-tools:mastery-abc",
+		},
+		{
+			name:  "digest only",
+			image: "gcr.io/istio-testing/build-tools@" + digest,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, ok, err := branchImage(tc.image, "release-1.12", tc.pin)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.expected == nil {
+				if ok {
+					t.Errorf("expected the image not to be tagged, got %+v", actual)
+				}
+				return
+			}
+			if !ok || !reflect.DeepEqual(*tc.expected, actual) {
+				t.Errorf("image tag does not match; actual: %+v\n expected %+v\n", actual, *tc.expected)
+			}
+		})
+	}
+
+	if _, _, err := branchImage("gcr.io/Istio:master", "release-1.12", false); err == nil {
+		t.Error("expected an error for an invalid image")
+	}
+}
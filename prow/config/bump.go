@@ -0,0 +1,232 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	v1 "k8s.io/api/core/v1"
+)
+
+// DefaultImageTagPattern matches the tags of the images built for a branch, e.g.
+// master-2021-07-13T17-42-03. {branch} is replaced with the branch of the meta config.
+const DefaultImageTagPattern = "{branch}-[0-9]{4}-[0-9]{2}-[0-9]{2}T[0-9]{2}-[0-9]{2}-[0-9]{2}"
+
+// BumpOptions configures the images bumped to their newest tag.
+type BumpOptions struct {
+	// TagPattern is the regular expression the tags of the images must fully match, with {branch}
+	// replaced with each branch of the meta config. DefaultImageTagPattern is used if it is empty.
+	TagPattern string
+	// Images only selects the images matching it, if set.
+	Images *regexp.Regexp
+}
+
+// BumpPlan lists the images bumped in the meta config files.
+type BumpPlan struct {
+	Bumps []ImageBump
+}
+
+// ImageBump is an image of a meta config file bumped to a newer tag.
+type ImageBump struct {
+	File string
+	Old  string
+	New  string
+}
+
+// PlanImageBump returns the images of the meta configs to bump to the newest tag of their
+// repository matching the tag pattern for the branches of the meta config, e.g. the images tagged
+// master-<timestamp> in the master meta configs. The newest tag is the greatest one in lexical
+// order, which is the latest one for timestamped tags. Only the images set in the meta config
+// files, on the file, its templates and its jobs, including their sidecars and init containers,
+// are bumped. The images pinned to a digest are pinned to the digest of the new tag.
+func (cli *Client) PlanImageBump(registry Registry, o BumpOptions, metaConfigs []MetaConfig) (*BumpPlan, error) {
+	if o.TagPattern == "" {
+		o.TagPattern = DefaultImageTagPattern
+	}
+	b := &imageBumper{registry: registry, tags: map[string][]string{}, newest: map[string]string{}}
+	p := &BumpPlan{}
+	for _, mc := range metaConfigs {
+		yamlFile, err := ioutil.ReadFile(mc.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", mc.Path, err)
+		}
+		raw := JobsConfig{}
+		if err := yaml.Unmarshal(yamlFile, &raw); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal %s: %v", mc.Path, err)
+		}
+
+		var patterns []*regexp.Regexp
+		for _, branch := range mc.JobsConfig.Branches {
+			re, err := regexp.Compile("^" + strings.ReplaceAll(o.TagPattern, "{branch}", regexp.QuoteMeta(branch)) + "$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid tag pattern %q: %v", o.TagPattern, err)
+			}
+			patterns = append(patterns, re)
+		}
+
+		bumped := map[string]bool{}
+		for _, image := range configImages(raw) {
+			if bumped[image] || o.Images != nil && !o.Images.MatchString(image) {
+				continue
+			}
+			bumped[image] = true
+			newImage, err := b.bump(image, patterns)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", mc.Path, err)
+			}
+			if newImage != image {
+				p.Bumps = append(p.Bumps, ImageBump{File: mc.Path, Old: image, New: newImage})
+			}
+		}
+	}
+	return p, nil
+}
+
+// configImages returns the images set in the meta config, in the file, the templates and the jobs,
+// including their sidecars and init containers.
+func configImages(jobs JobsConfig) []string {
+	images := []string{jobs.Image}
+	var templates []string
+	for name := range jobs.Templates {
+		templates = append(templates, name)
+	}
+	sort.Strings(templates)
+	for _, name := range templates {
+		images = append(images, jobImages(jobs.Templates[name])...)
+	}
+	for _, job := range jobs.Jobs {
+		images = append(images, jobImages(job)...)
+	}
+
+	var res []string
+	for _, image := range images {
+		if image != "" {
+			res = append(res, image)
+		}
+	}
+	return res
+}
+
+// jobImages returns the images of the job, its sidecars and its init containers.
+func jobImages(job Job) []string {
+	images := []string{job.Image}
+	for _, c := range append(append([]v1.Container{}, job.Sidecars...), job.InitContainers...) {
+		images = append(images, c.Image)
+	}
+	return images
+}
+
+// imageBumper resolves the newest tags of the images, listing the tags of each repository once.
+type imageBumper struct {
+	registry Registry
+	tags     map[string][]string
+	newest   map[string]string
+}
+
+// bump returns the image with the newest tag matching the pattern its tag matches, or the image
+// itself if its tag matches none of them.
+func (b *imageBumper) bump(image string, patterns []*regexp.Regexp) (string, error) {
+	ref, err := parseImage(image)
+	if err != nil {
+		return "", fmt.Errorf("invalid image %s: %v", image, err)
+	}
+	var pattern *regexp.Regexp
+	for _, re := range patterns {
+		if re.MatchString(ref.Tag) {
+			pattern = re
+		}
+	}
+	if pattern == nil {
+		return image, nil
+	}
+
+	key := ref.Repository + " " + pattern.String()
+	newest, ok := b.newest[key]
+	if !ok {
+		tags, ok := b.tags[ref.Repository]
+		if !ok {
+			if tags, err = b.registry.ListTags(ref.Repository); err != nil {
+				return "", err
+			}
+			b.tags[ref.Repository] = tags
+		}
+		for _, tag := range tags {
+			if pattern.MatchString(tag) && tag > newest {
+				newest = tag
+			}
+		}
+		b.newest[key] = newest
+	}
+	if newest <= ref.Tag {
+		return image, nil
+	}
+
+	newRef := imageRef{Repository: ref.Repository, Tag: newest}
+	if ref.Digest != "" {
+		if newRef.Digest, err = b.registry.Digest(newRef.String()); err != nil {
+			return "", err
+		}
+	}
+	return newRef.String(), nil
+}
+
+// Apply rewrites the images in the meta config files. The files are edited as text, so that their
+// comments and the order of their fields are kept.
+func (p *BumpPlan) Apply() error {
+	var files []string
+	bumps := map[string][]ImageBump{}
+	for _, bump := range p.Bumps {
+		if _, ok := bumps[bump.File]; !ok {
+			files = append(files, bump.File)
+		}
+		bumps[bump.File] = append(bumps[bump.File], bump)
+	}
+	for _, f := range files {
+		content, err := ioutil.ReadFile(f)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", f, err)
+		}
+		lines := strings.Split(string(content), "\n")
+		for _, bump := range bumps[f] {
+			re := regexp.MustCompile(`^(\s*(?:-\s+)?image:\s*["']?)` + regexp.QuoteMeta(bump.Old) + `(["']?\s*(?:#.*)?)$`)
+			for i, l := range lines {
+				lines[i] = re.ReplaceAllString(l, "${1}"+strings.ReplaceAll(bump.New, "$", "$$")+"${2}")
+			}
+		}
+		if err := ioutil.WriteFile(f, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %v", f, err)
+		}
+	}
+	return nil
+}
+
+// Write writes the plan in a human readable form.
+func (p *BumpPlan) Write(w io.Writer) error {
+	var sb strings.Builder
+	if len(p.Bumps) == 0 {
+		sb.WriteString("All the images are up to date.\n")
+	}
+	for _, bump := range p.Bumps {
+		fmt.Fprintf(&sb, "- bump %s to %s in %s\n", bump.Old, bump.New, bump.File)
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
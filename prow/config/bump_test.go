@@ -0,0 +1,135 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestImageBump(t *testing.T) {
+	host, stop := startRegistry()
+	defer stop()
+	buildTools := host + "/istio-testing/build-tools"
+	for _, tag := range []string{"master-2021-07-13T17-42-03", "release-1.11-2021-07-14T19-43-48", "release-1.11-2021-09-01T00-00-00", "master-latest"} {
+		pushImage(t, buildTools+":"+tag)
+	}
+	newest := buildTools + ":master-2021-08-01T00-00-00"
+	newestDigest := pushImage(t, newest)
+	pushImage(t, host+"/istio-testing/proxy:master-2021-07-13T17-42-03")
+	registry := host + "/istio-testing/registry"
+	for _, tag := range []string{"master-2021-07-13T17-42-03", "master-2021-07-20T00-00-00", "master-2021-08-01T00-00-00"} {
+		pushImage(t, registry+":"+tag)
+	}
+
+	dir, err := ioutil.TempDir("", "bump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	const master = `# The master jobs.
+org: istio
+repo: istio
+image: {host}/istio-testing/build-tools:master-2021-07-13T17-42-03 # the default image
+
+templates:
+  pinned:
+    image: "{host}/istio-testing/build-tools:master-2021-07-13T17-42-03@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+jobs:
+- name: unit-tests
+  command: [make, test]
+- image: {host}/istio-testing/proxy:master-2021-07-13T17-42-03
+  name: proxy-tests
+  command: [make, test]
+- name: envoy-tests
+  image: envoyproxy/envoy-build-ubuntu:e33c93e6d79804bf95ff80426d10bdcc9096c785
+  command: [make, test]
+- name: registry-tests
+  command: [make, test]
+  sidecars:
+  - name: registry
+    image: {host}/istio-testing/registry:master-2021-07-13T17-42-03
+  init_containers:
+  - image: {host}/istio-testing/registry:master-2021-07-20T00-00-00
+    name: setup
+`
+	const release = `org: istio
+repo: istio
+branches: [release-1.11]
+image: {host}/istio-testing/build-tools:release-1.11-2021-07-14T19-43-48
+jobs:
+- name: unit-tests
+  command: [make, test]
+`
+	files := map[string]string{"istio.yaml": master, "istio-1.11.yaml": release}
+	for f, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, f), []byte(strings.ReplaceAll(content, "{host}", host)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cli := &Client{}
+	metaConfigs, err := cli.ReadJobsConfigs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := cli.PlanImageBump(NewOCIRegistry(), BumpOptions{Images: regexp.MustCompile("build-tools|registry")}, metaConfigs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Bumps) != 5 {
+		t.Fatalf("expected 5 images to bump, got %+v", plan.Bumps)
+	}
+	if err := plan.Apply(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"istio.yaml": strings.NewReplacer(
+			"build-tools:master-2021-07-13T17-42-03 #", "build-tools:master-2021-08-01T00-00-00 #",
+			"build-tools:master-2021-07-13T17-42-03@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+			"build-tools:master-2021-08-01T00-00-00@"+newestDigest,
+			"registry:master-2021-07-13T17-42-03", "registry:master-2021-08-01T00-00-00",
+			"registry:master-2021-07-20T00-00-00", "registry:master-2021-08-01T00-00-00",
+		).Replace(master),
+		"istio-1.11.yaml": strings.ReplaceAll(release, "release-1.11-2021-07-14T19-43-48", "release-1.11-2021-09-01T00-00-00"),
+	}
+	for f, content := range expected {
+		actual, err := ioutil.ReadFile(filepath.Join(dir, f))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if content = strings.ReplaceAll(content, "{host}", host); string(actual) != content {
+			t.Errorf("%s does not match; actual:\n%s\nexpected:\n%s", f, actual, content)
+		}
+	}
+
+	// The images are up to date now.
+	if metaConfigs, err = cli.ReadJobsConfigs(dir); err != nil {
+		t.Fatal(err)
+	}
+	plan, err = cli.PlanImageBump(NewOCIRegistry(), BumpOptions{}, metaConfigs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Bumps) != 0 {
+		t.Errorf("expected the images to be up to date, got %+v", plan.Bumps)
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"k8s.io/test-infra/prow/config"
+)
+
+const (
+	// AffectedAlwaysRun is the reason of the presubmits running for any change.
+	AffectedAlwaysRun = "always runs"
+	// AffectedRunIfChanged is the reason of the presubmits running because a change matches their
+	// run_if_changed regex.
+	AffectedRunIfChanged = "run_if_changed"
+	// AffectedSkipIfOnlyChanged is the reason of the presubmits running because a change does not
+	// match their skip_if_only_changed regex.
+	AffectedSkipIfOnlyChanged = "skip_if_only_changed"
+)
+
+// GlobsToRegex compiles the path globs to a regex matching any of them, for the Prow
+// run_if_changed and skip_if_only_changed fields. The globs are relative to the root of the repo.
+// `*` matches any characters but `/`, `?` any single character but `/`, and `**` any number of
+// directories, e.g. `pkg/**/*.go` matches all the go files under pkg. A glob ending with `/`
+// matches all the files under the directory.
+func GlobsToRegex(globs []string) (string, error) {
+	var exprs []string
+	for _, glob := range globs {
+		if glob == "" || path.IsAbs(glob) {
+			return "", fmt.Errorf("invalid path %q, must be a path relative to the root of the repo", glob)
+		}
+		if strings.HasSuffix(glob, "/") {
+			glob += "**"
+		}
+		var sb strings.Builder
+		for i := 0; i < len(glob); i++ {
+			switch {
+			case strings.HasPrefix(glob[i:], "**/"):
+				sb.WriteString("(?:.*/)?")
+				i += 2
+			case strings.HasPrefix(glob[i:], "**"):
+				sb.WriteString(".*")
+				i++
+			case glob[i] == '*':
+				sb.WriteString("[^/]*")
+			case glob[i] == '?':
+				sb.WriteString("[^/]")
+			default:
+				sb.WriteString(regexpQuoteByte(glob[i]))
+			}
+		}
+		exprs = append(exprs, sb.String())
+	}
+	return "^(?:" + strings.Join(exprs, "|") + ")$", nil
+}
+
+func regexpQuoteByte(b byte) string {
+	if strings.IndexByte(`\.+()|[]{}^$`, b) >= 0 {
+		return `\` + string(b)
+	}
+	return string(b)
+}
+
+// changeMatcher returns the Prow matcher of the changed files triggering the job. For Gerrit, the
+// files Gerrit adds to every change are ignored by skip_if_only_changed, so that a change of only
+// the skipped files does not run the job anyway.
+func changeMatcher(jobsConfig JobsConfig, job Job) (config.RegexpChangeMatcher, error) {
+	if len(job.RunIfChangedPaths) > 0 {
+		re, err := GlobsToRegex(job.RunIfChangedPaths)
+		return config.RegexpChangeMatcher{RunIfChanged: re}, err
+	}
+	if len(job.SkipIfOnlyChangedPaths) > 0 {
+		re, err := GlobsToRegex(job.SkipIfOnlyChangedPaths)
+		if jobsConfig.Gerrit != nil {
+			re = gerritMagicFiles + "|" + re
+		}
+		return config.RegexpChangeMatcher{SkipIfOnlyChanged: re}, err
+	}
+	return config.RegexpChangeMatcher{RunIfChanged: job.Regex}, nil
+}
+
+// AffectedJob is a presubmit triggered by a change.
+type AffectedJob struct {
+	Name string
+	Ref  Ref
+	// Reason is why the presubmit is triggered, one of AffectedAlwaysRun, AffectedRunIfChanged and
+	// AffectedSkipIfOnlyChanged.
+	Reason string
+}
+
+// AffectedPresubmits returns the presubmits triggered by a pull request changing the given files,
+// relative to the root of the repo, sorted by org/repo:branch and name. The presubmits only run
+// on demand are not triggered.
+func (cli *Client) AffectedPresubmits(metaConfigs []MetaConfig, changes []string) ([]AffectedJob, error) {
+	changed := func() ([]string, error) {
+		return changes, nil
+	}
+	var res []AffectedJob
+	for _, mc := range metaConfigs {
+		for _, branch := range mc.JobsConfig.Branches {
+			jc, err := cli.ConvertJobConfig(mc.JobsConfig, branch)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", mc.Path, err)
+			}
+			ref := Ref{Org: mc.JobsConfig.Org, Repo: mc.JobsConfig.Repo, Branch: branch}
+			for _, presubmits := range jc.PresubmitsStatic {
+				if err := config.SetPresubmitRegexes(presubmits); err != nil {
+					return nil, fmt.Errorf("%s: %v", mc.Path, err)
+				}
+				for _, ps := range presubmits {
+					run, err := ps.ShouldRun(branch, changed, false, false)
+					if err != nil {
+						return nil, fmt.Errorf("%s: %v", mc.Path, err)
+					}
+					if !run {
+						continue
+					}
+					reason := AffectedAlwaysRun
+					if ps.RunIfChanged != "" {
+						reason = AffectedRunIfChanged
+					} else if ps.SkipIfOnlyChanged != "" {
+						reason = AffectedSkipIfOnlyChanged
+					}
+					res = append(res, AffectedJob{Name: ps.Name, Ref: ref, Reason: reason})
+				}
+			}
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Ref != res[j].Ref {
+			return res[i].Ref.String() < res[j].Ref.String()
+		}
+		return res[i].Name < res[j].Name
+	})
+	return res, nil
+}
@@ -0,0 +1,160 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestGlobsToRegex(t *testing.T) {
+	testCases := []struct {
+		globs     []string
+		matches   []string
+		unmatches []string
+	}{
+		{
+			globs:     []string{"go.mod"},
+			matches:   []string{"go.mod"},
+			unmatches: []string{"gozmod", "pkg/go.mod", "go.mod.bak"},
+		},
+		{
+			globs:     []string{"*.go"},
+			matches:   []string{"main.go"},
+			unmatches: []string{"pkg/main.go"},
+		},
+		{
+			globs:     []string{"pkg/**/*.go"},
+			matches:   []string{"pkg/main.go", "pkg/a/b/main.go"},
+			unmatches: []string{"main.go", "pkg/main.go.txt"},
+		},
+		{
+			globs:     []string{"**/*.md", "docs/"},
+			matches:   []string{"README.md", "a/b/README.md", "docs/index.html"},
+			unmatches: []string{"docs", "pkg/main.go"},
+		},
+		{
+			globs:     []string{"tests/**", "v?/*"},
+			matches:   []string{"tests/a/b", "v1/a"},
+			unmatches: []string{"tests", "v10/a", "v1/a/b"},
+		},
+	}
+	for _, tc := range testCases {
+		expr, err := GlobsToRegex(tc.globs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		re := regexp.MustCompile(expr)
+		for _, m := range tc.matches {
+			if !re.MatchString(m) {
+				t.Errorf("expected %v (%s) to match %s", tc.globs, expr, m)
+			}
+		}
+		for _, m := range tc.unmatches {
+			if re.MatchString(m) {
+				t.Errorf("expected %v (%s) not to match %s", tc.globs, expr, m)
+			}
+		}
+	}
+
+	for _, globs := range [][]string{{""}, {"/pkg"}} {
+		if _, err := GlobsToRegex(globs); err == nil {
+			t.Errorf("expected an error for %v", globs)
+		}
+	}
+}
+
+func TestAffectedPresubmits(t *testing.T) {
+	cli := &Client{}
+	jobs := JobsConfig{
+		Org:      "istio",
+		Repo:     "istio",
+		Branches: []string{"master"},
+		Image:    "foo",
+		Jobs: []Job{
+			{Name: "unit", Types: []string{TypePresubmit}},
+			{Name: "go", Types: []string{TypePresubmit}, RunIfChangedPaths: []string{"pkg/**/*.go"}},
+			{Name: "docs", Types: []string{TypePresubmit}, SkipIfOnlyChangedPaths: []string{"**/*.go"}},
+			{Name: "regex", Types: []string{TypePresubmit}, Regex: "^tools/"},
+			{Name: "manual", Types: []string{TypePresubmit}, TriggerMode: TriggerModeManual},
+			{Name: "post", Types: []string{TypePostsubmit}},
+		},
+	}
+	metaConfigs := []MetaConfig{{Path: "istio.yaml", JobsConfig: jobs}}
+	ref := Ref{Org: "istio", Repo: "istio", Branch: "master"}
+
+	testCases := []struct {
+		name     string
+		changes  []string
+		expected []AffectedJob
+	}{
+		{
+			name:    "go files",
+			changes: []string{"pkg/a/main.go"},
+			expected: []AffectedJob{
+				{Name: "go_istio", Ref: ref, Reason: AffectedRunIfChanged},
+				{Name: "unit_istio", Ref: ref, Reason: AffectedAlwaysRun},
+			},
+		},
+		{
+			name:    "docs and tools",
+			changes: []string{"README.md", "tools/build.sh"},
+			expected: []AffectedJob{
+				{Name: "docs_istio", Ref: ref, Reason: AffectedSkipIfOnlyChanged},
+				{Name: "regex_istio", Ref: ref, Reason: AffectedRunIfChanged},
+				{Name: "unit_istio", Ref: ref, Reason: AffectedAlwaysRun},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := cli.AffectedPresubmits(metaConfigs, tc.changes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tc.expected, actual) {
+				t.Errorf("affected presubmits do not match; actual: %v\n expected %v\n", actual, tc.expected)
+			}
+		})
+	}
+}
+
+func TestAffectedPresubmitsGerrit(t *testing.T) {
+	cli := &Client{}
+	jobs := JobsConfig{
+		Org:      "istio",
+		Repo:     "proxy",
+		Branches: []string{"master"},
+		Image:    "foo",
+		Gerrit:   &GerritConfig{Host: "istio-review.googlesource.com"},
+		Jobs: []Job{
+			{Name: "unit", Types: []string{TypePresubmit}},
+			{Name: "build", Types: []string{TypePresubmit}, SkipIfOnlyChangedPaths: []string{"**/*.md"}},
+		},
+	}
+	metaConfigs := []MetaConfig{{Path: "proxy.yaml", JobsConfig: jobs}}
+
+	// Gerrit lists the commit message as changed by every change, which must not trigger the jobs
+	// skipping the docs.
+	actual, err := cli.AffectedPresubmits(metaConfigs, []string{"/COMMIT_MSG", "README.md"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []AffectedJob{{Name: "unit_proxy", Ref: Ref{Org: "istio", Repo: "proxy", Branch: "master"}, Reason: AffectedAlwaysRun}}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("affected presubmits do not match; actual: %v\n expected %v\n", actual, expected)
+	}
+}
@@ -15,166 +15,892 @@
 package main
 
 import (
-	"flag"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
-	"path"
 	"path/filepath"
 	"regexp"
+	"strings"
+	"text/tabwriter"
 
+	flag "github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/util/sets"
 	k8sProwConfig "k8s.io/test-infra/prow/config"
 
 	"istio.io/test-infra/prow/config"
 )
 
-func exit(err error, context string) {
-	if context == "" {
-		_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
-	} else {
-		_, _ = fmt.Fprintf(os.Stderr, "%v: %v\n", context, err)
+const (
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+// usageError is returned for invalid command line arguments, which exit with exitUsage.
+type usageError struct {
+	message string
+}
+
+func (e usageError) Error() string {
+	return e.message
+}
+
+func usageErrorf(format string, args ...interface{}) error {
+	return usageError{message: fmt.Sprintf(format, args...)}
+}
+
+// options are the command-line flags shared by the commands.
+type options struct {
+	inputDir  string
+	outputDir string
+
+	org    string
+	repo   string
+	branch string
+	job    string
+
+	jobRegex *regexp.Regexp
+}
+
+func (o *options) addDirFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.inputDir, "input-dir", "../jobs", "Directory of the meta config files.")
+	fs.StringVar(&o.outputDir, "output-dir", "../../cluster/jobs", "Directory of the generated job config files.")
+}
+
+// addFilterFlags adds the flags to select the org/repo:branch to operate on, and the jobs if
+// withJob is set.
+func (o *options) addFilterFlags(fs *flag.FlagSet, withJob bool) {
+	fs.StringVar(&o.org, "org", "", "Only operate on the meta configs of this org.")
+	fs.StringVar(&o.repo, "repo", "", "Only operate on the meta configs of this repo.")
+	fs.StringVar(&o.branch, "branch", "", "Only operate on this branch.")
+	if withJob {
+		fs.StringVar(&o.job, "job", "", "Only operate on the jobs whose name matches this regular expression.")
 	}
-	os.Exit(1)
 }
 
-func GetFileName(repo string, org string, branch string) string {
-	key := fmt.Sprintf("%s.%s.%s.gen.yaml", org, repo, branch)
-	return path.Join(*outputDir, org, repo, key)
+func (o *options) filtered() bool {
+	return o.org != "" || o.repo != "" || o.branch != "" || o.job != ""
 }
 
-var (
-	inputDir  = flag.String("input-dir", "../jobs", "directory of input jobs")
-	outputDir = flag.String("output-dir", "../../cluster/jobs", "directory of output jobs")
-)
+// filterMetaConfigs returns the meta configs selected by the org, repo and branch filters.
+func (o *options) filterMetaConfigs(metaConfigs []config.MetaConfig) []config.MetaConfig {
+	var res []config.MetaConfig
+	for _, mc := range metaConfigs {
+		if o.org != "" && mc.JobsConfig.Org != o.org || o.repo != "" && mc.JobsConfig.Repo != o.repo {
+			continue
+		}
+		if o.branch != "" {
+			found := false
+			for _, b := range mc.JobsConfig.Branches {
+				if b == o.branch {
+					found = true
+				}
+			}
+			if !found {
+				continue
+			}
+			mc.JobsConfig.Branches = []string{o.branch}
+		}
+		res = append(res, mc)
+	}
+	return res
+}
 
-func main() {
-	flag.Parse()
+// filterJobs returns the generated jobs selected by the job filter.
+func (o *options) filterJobs(jc k8sProwConfig.JobConfig) k8sProwConfig.JobConfig {
+	if o.jobRegex == nil {
+		return jc
+	}
+	res := k8sProwConfig.JobConfig{
+		PresubmitsStatic:  map[string][]k8sProwConfig.Presubmit{},
+		PostsubmitsStatic: map[string][]k8sProwConfig.Postsubmit{},
+		Periodics:         []k8sProwConfig.Periodic{},
+	}
+	for orgRepo, jobs := range jc.PresubmitsStatic {
+		for _, job := range jobs {
+			if o.jobRegex.MatchString(job.Name) {
+				res.PresubmitsStatic[orgRepo] = append(res.PresubmitsStatic[orgRepo], job)
+			}
+		}
+	}
+	for orgRepo, jobs := range jc.PostsubmitsStatic {
+		for _, job := range jobs {
+			if o.jobRegex.MatchString(job.Name) {
+				res.PostsubmitsStatic[orgRepo] = append(res.PostsubmitsStatic[orgRepo], job)
+			}
+		}
+	}
+	for _, job := range jc.Periodics {
+		if o.jobRegex.MatchString(job.Name) {
+			res.Periodics = append(res.Periodics, job)
+		}
+	}
+	return res
+}
 
-	// TODO: deserves a better CLI...
-	if len(flag.Args()) < 1 {
-		panic("must provide one of write, diff, print, branch")
-	} else if flag.Arg(0) == "branch" {
-		if len(flag.Args()) != 2 {
-			panic("must specify branch name")
+// client creates the config client with the global config of the input directory, if there is one.
+func (o *options) client() (*config.Client, error) {
+	if o.job != "" {
+		re, err := regexp.Compile(o.job)
+		if err != nil {
+			return nil, usageErrorf("invalid --job regular expression: %v", err)
 		}
-	} else if len(flag.Args()) != 1 {
-		panic("too many arguments")
+		o.jobRegex = re
 	}
 
 	var settings config.GlobalConfig
-	if _, err := os.Stat(filepath.Join(*inputDir, ".global.yaml")); !os.IsNotExist(err) {
-		settings = config.ReadGlobalSettings(filepath.Join(*inputDir, ".global.yaml"))
+	globalFile := filepath.Join(o.inputDir, config.GlobalConfigFile)
+	if _, err := os.Stat(globalFile); !os.IsNotExist(err) {
+		settings, err = config.ReadGlobalSettings(globalFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &config.Client{GlobalConfig: settings}, nil
+}
+
+// readJobsConfigs reads the meta configs selected by the filters.
+func (o *options) readJobsConfigs(cli *config.Client) ([]config.MetaConfig, error) {
+	metaConfigs, err := cli.ReadJobsConfigs(o.inputDir)
+	if err != nil {
+		return nil, err
 	}
-	cli := &config.Client{GlobalConfig: settings}
+	return o.filterMetaConfigs(metaConfigs), nil
+}
+
+// generate reads, validates and converts the meta configs selected by the filters.
+func (o *options) generate(cli *config.Client) (map[config.Ref]k8sProwConfig.JobConfig, error) {
+	metaConfigs, err := o.readJobsConfigs(cli)
+	if err != nil {
+		return nil, err
+	}
+	if err := cli.ValidateJobsConfigs(metaConfigs); err != nil {
+		return nil, fmt.Errorf("validation failed: %v", err)
+	}
+	output, err := cli.GenerateJobConfigs(metaConfigs)
+	if err != nil {
+		return nil, err
+	}
+	for r, jc := range output {
+		output[r] = o.filterJobs(jc)
+	}
+	return output, nil
+}
 
-	if os.Args[1] == "branch" {
-		if err := filepath.Walk(*inputDir, func(src string, file os.FileInfo, err error) error {
+// command is a subcommand of the generator.
+type command struct {
+	name string
+	args string
+	help string
+	// setup registers the flags of the command and returns the function running it.
+	setup func(fs *flag.FlagSet, o *options) func(args []string) error
+}
+
+var commands = []command{
+	{
+		name:  "write",
+		help:  "Write the generated job configs to the output directory, and remove the generated files no meta config produces anymore.",
+		setup: setupWrite,
+	},
+	{
+		name:  "diff",
+		help:  "Report the jobs added, removed and changed compared to the existing generated job configs.",
+		setup: setupDiff,
+	},
+	{
+		name:  "print",
+		help:  "Print the generated job configs to stdout.",
+		setup: setupPrint,
+	},
+	{
+		name:  "check",
+		help:  "Check that the generated files in the output directory are up to date.",
+		setup: setupCheck,
+	},
+	{
+		name:  "validate",
+		help:  "Validate the meta config files.",
+		setup: setupValidate,
+	},
+	{
+		name:  "list",
+		help:  "List the jobs of the meta configs, with the global and repo settings resolved.",
+		setup: setupList,
+	},
+	{
+		name:  "affected",
+		args:  "<file...>",
+		help:  "List the presubmits a pull request changing the given files, relative to the repo root, would trigger.",
+		setup: setupAffected,
+	},
+	{
+		name:  "explain",
+		args:  "<job-name>",
+		help:  "Explain which meta config job generates a Prow job, and the chain of settings it inherits.",
+		setup: setupExplain,
+	},
+	{
+		name:  "testgrid",
+		help:  "Generate a standalone TestGrid config of the dashboards of the jobs added to testgrid.",
+		setup: setupTestgrid,
+	},
+	{
+		name:  "branch",
+		args:  "<version>",
+		help:  "Create the release-<version> branch from the meta configs and transform configs supporting release branching, and regenerate the jobs.",
+		setup: setupBranch,
+	},
+	{
+		name:  "unbranch",
+		args:  "<version>",
+		help:  "Remove the meta configs, generated jobs and branch protection of the release-<version> branch.",
+		setup: setupUnbranch,
+	},
+	{
+		name:  "bump",
+		help:  "Bump the images of the meta configs to their newest tag for the branch, and regenerate the jobs.",
+		setup: setupBump,
+	},
+}
+
+func usage() {
+	w := os.Stderr
+	_, _ = fmt.Fprintf(w, "Generates the Prow job configs from the meta config files.\n\n")
+	_, _ = fmt.Fprintf(w, "Usage:\n  generate <command> [flags]\n\nCommands:\n")
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, c := range commands {
+		_, _ = fmt.Fprintf(tw, "  %s\t%s\n", c.name, c.help)
+	}
+	_ = tw.Flush()
+	_, _ = fmt.Fprintf(w, "\nRun 'generate <command> --help' for the flags of a command.\n")
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	if len(args) < 1 {
+		usage()
+		return exitUsage
+	}
+	if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		usage()
+		return 0
+	}
+
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == args[0] {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		_, _ = fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[0])
+		usage()
+		return exitUsage
+	}
+
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(os.Stderr, "%s\n\nUsage:\n  generate %s [flags] %s\n\nFlags:\n%s", cmd.help, cmd.name, cmd.args, fs.FlagUsages())
+	}
+	o := &options{}
+	o.addDirFlags(fs)
+	runCmd := cmd.setup(fs, o)
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return exitUsage
+	}
+
+	if err := runCmd(fs.Args()); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%s failed: %v\n", cmd.name, err)
+		var uerr usageError
+		if errors.As(err, &uerr) {
+			fs.Usage()
+			return exitUsage
+		}
+		return exitFailure
+	}
+	return 0
+}
+
+func noArgs(args []string) error {
+	if len(args) != 0 {
+		return usageErrorf("unexpected arguments %v", args)
+	}
+	return nil
+}
+
+func setupWrite(fs *flag.FlagSet, o *options) func(args []string) error {
+	o.addFilterFlags(fs, false)
+	dryRun := fs.Bool("dry-run", false, "Only report the files that would be written or removed.")
+	return func(args []string) error {
+		if err := noArgs(args); err != nil {
+			return err
+		}
+		cli, err := o.client()
+		if err != nil {
+			return err
+		}
+		return o.write(cli, *dryRun)
+	}
+}
+
+// write writes the generated job configs, and removes the stale generated files.
+func (o *options) write(cli *config.Client, dryRun bool) error {
+	output, err := o.generate(cli)
+	if err != nil {
+		return err
+	}
+
+	var generated []string
+	for _, r := range config.SortedRefs(output) {
+		fname := r.FileName(o.outputDir)
+		generated = append(generated, fname)
+		if dryRun {
+			log.Println("would write", fname)
+			continue
+		}
+		if err := cli.WriteConfig(output[r], fname); err != nil {
+			return err
+		}
+	}
+
+	// Only a full generation knows all the files that are still generated.
+	if o.filtered() {
+		return nil
+	}
+	// Remove the files generated for an org/repo:branch whose meta config was deleted.
+	stale, err := cli.PruneStaleFiles(o.outputDir, generated, dryRun)
+	if err != nil {
+		return err
+	}
+	for _, f := range stale {
+		if dryRun {
+			log.Println("would remove", f)
+		} else {
+			log.Println("removed", f)
+		}
+	}
+	return nil
+}
+
+func setupDiff(fs *flag.FlagSet, o *options) func(args []string) error {
+	o.addFilterFlags(fs, true)
+	format := fs.String("format", config.DiffFormatMarkdown, "Format of the diff report, one of json, markdown.")
+	return func(args []string) error {
+		if err := noArgs(args); err != nil {
+			return err
+		}
+		if *format != config.DiffFormatJSON && *format != config.DiffFormatMarkdown {
+			return usageErrorf("unknown format %q", *format)
+		}
+		cli, err := o.client()
+		if err != nil {
+			return err
+		}
+		output, err := o.generate(cli)
+		if err != nil {
+			return err
+		}
+
+		report := &config.DiffReport{}
+		var generated []string
+		for _, r := range config.SortedRefs(output) {
+			fname := r.FileName(o.outputDir)
+			generated = append(generated, fname)
+			// A missing file means that all the jobs for this org/repo:branch are new.
+			var existing k8sProwConfig.JobConfig
+			if _, err := os.Stat(fname); err == nil {
+				existing, err = config.ReadProwJobConfig(fname)
+				if err != nil {
+					return err
+				}
+				existing = o.filterJobs(existing)
+			}
+			diffs, err := config.DiffJobConfig(r.Org, r.Repo, r.Branch, output[r], existing)
 			if err != nil {
-				fmt.Printf("error: %s\n", err.Error())
+				return err
 			}
-
-			if file.IsDir() {
-				return nil
+			report.Jobs = append(report.Jobs, diffs...)
+		}
+		// Only a full generation knows all the files that are still generated.
+		if !o.filtered() {
+			removed, err := cli.DiffStaleFiles(o.outputDir, generated)
+			if err != nil {
+				return err
 			}
-			if filepath.Ext(file.Name()) != ".yaml" && filepath.Ext(file.Name()) != ".yml" || file.Name() == ".global.yaml" {
-				log.Println("skipping", file.Name())
-				return nil
+			report.Jobs = append(report.Jobs, removed...)
+		}
+		report.Sort()
+		return report.Write(os.Stdout, *format)
+	}
+}
+
+func setupPrint(fs *flag.FlagSet, o *options) func(args []string) error {
+	o.addFilterFlags(fs, true)
+	return func(args []string) error {
+		if err := noArgs(args); err != nil {
+			return err
+		}
+		cli, err := o.client()
+		if err != nil {
+			return err
+		}
+		output, err := o.generate(cli)
+		if err != nil {
+			return err
+		}
+		for _, r := range config.SortedRefs(output) {
+			if err := cli.PrintConfig(output[r]); err != nil {
+				return err
 			}
-			jobs := cli.ReadJobsConfig(src)
-			jobs.Jobs = config.FilterReleaseBranchingJobs(jobs.Jobs)
-
-			if jobs.SupportReleaseBranching {
-				tagRegex := regexp.MustCompile(`^(.+):(.+)-([0-9]{4}-[0-9]{2}-[0-9]{2}T[0-9]{2}-[0-9]{2}-[0-9]{2})$`)
-				match := tagRegex.FindStringSubmatch(jobs.Image)
-				branch := "release-" + flag.Arg(1)
-				if len(match) == 4 {
-					newImage := fmt.Sprintf("%s:%s-%s", match[1], branch, match[3])
-					if err := exec.Command("gcloud", "container", "images", "add-tag", match[0], newImage).Run(); err != nil {
-						exit(err, "unable to add image tag: "+newImage)
-					} else {
-						jobs.Image = newImage
-					}
-				}
-				jobs.Branches = []string{branch}
-				jobs.SupportReleaseBranching = false
+		}
+		return nil
+	}
+}
 
-				name := file.Name()
-				ext := filepath.Ext(name)
-				name = name[:len(name)-len(ext)] + "-" + flag.Arg(1) + ext
+func setupCheck(fs *flag.FlagSet, o *options) func(args []string) error {
+	o.addFilterFlags(fs, false)
+	return func(args []string) error {
+		if err := noArgs(args); err != nil {
+			return err
+		}
+		cli, err := o.client()
+		if err != nil {
+			return err
+		}
+		return o.check(cli)
+	}
+}
 
-				dst := path.Join(*inputDir, name)
-				if err := config.WriteJobConfig(jobs, dst); err != nil {
-					exit(err, "writing branched config failed")
-				}
-			}
+// check checks that the generated files are up to date.
+func (o *options) check(cli *config.Client) error {
+	output, err := o.generate(cli)
+	if err != nil {
+		return err
+	}
 
+	var outdated, generated []string
+	for _, r := range config.SortedRefs(output) {
+		fname := r.FileName(o.outputDir)
+		generated = append(generated, fname)
+		if err := cli.CheckConfig(output[r], fname); err != nil {
+			outdated = append(outdated, fname)
+		}
+	}
+	var stale []string
+	// Only a full generation knows all the files that are still generated.
+	if !o.filtered() {
+		stale, err = cli.FindStaleFiles(o.outputDir, generated)
+		if err != nil {
+			return err
+		}
+	}
+	if len(outdated) == 0 && len(stale) == 0 {
+		return nil
+	}
+	for _, f := range outdated {
+		_, _ = fmt.Fprintf(os.Stderr, "out of date: %s\n", f)
+	}
+	for _, f := range stale {
+		_, _ = fmt.Fprintf(os.Stderr, "not generated by any meta config: %s\n", f)
+	}
+	return fmt.Errorf("%d generated files are not up to date, run `make generate-config` to fix it",
+		len(outdated)+len(stale))
+}
+
+func setupValidate(fs *flag.FlagSet, o *options) func(args []string) error {
+	o.addFilterFlags(fs, false)
+	prowConfig := fs.String("prow-config", "../../config.yaml",
+		"Prow config file to validate the generated jobs with. The generated jobs are not validated by Prow if empty.")
+	return func(args []string) error {
+		if err := noArgs(args); err != nil {
+			return err
+		}
+		cli, err := o.client()
+		if err != nil {
+			return err
+		}
+		metaConfigs, err := o.readJobsConfigs(cli)
+		if err != nil {
+			return err
+		}
+		if err := cli.ValidateJobsConfigs(metaConfigs); err != nil {
+			return err
+		}
+		if *prowConfig == "" {
 			return nil
-		}); err != nil {
-			exit(err, "walking through the meta config files failed")
-		}
-	} else {
-		type ref struct {
-			org    string
-			repo   string
-			branch string
-		}
-		// Store the job config generated from all meta-config files in a cache map, and combine the
-		// job configs before we generate the final config files.
-		// In this way we can have multiple meta-config files for the same org/repo:branch
-		cachedOutput := map[ref]k8sProwConfig.JobConfig{}
-		if err := filepath.Walk(*inputDir, func(src string, file os.FileInfo, err error) error {
-			if file.IsDir() {
-				return nil
+		}
+		return cli.ValidateProwConfig(*prowConfig, metaConfigs)
+	}
+}
+
+func setupList(fs *flag.FlagSet, o *options) func(args []string) error {
+	o.addFilterFlags(fs, true)
+	requirements := fs.StringSlice("requirement", nil, "Only list the jobs with this requirement. Can be repeated.")
+	resource := fs.String("resource", "", "Only list the jobs using this resource preset.")
+	cluster := fs.String("cluster", "", "Only list the jobs running in this cluster.")
+	jobType := fs.String("type", "", "Only list the jobs of this type, one of presubmit, postsubmit, periodic.")
+	modifier := fs.String("modifier", "", "Only list the jobs with this modifier.")
+	image := fs.String("image", "", "Only list the jobs whose image matches this regular expression.")
+	labels := fs.StringSlice("label", nil, "Only list the jobs with this label, as key or key=value. Can be repeated.")
+	format := fs.String("format", "table", "Output format, one of table, json.")
+	return func(args []string) error {
+		if err := noArgs(args); err != nil {
+			return err
+		}
+		if *format != "table" && *format != "json" {
+			return usageErrorf("unknown format %q", *format)
+		}
+		cli, err := o.client()
+		if err != nil {
+			return err
+		}
+		q := config.JobQuery{
+			Name:         o.jobRegex,
+			Requirements: *requirements,
+			Resource:     *resource,
+			Cluster:      *cluster,
+			Type:         *jobType,
+			Modifier:     *modifier,
+			Labels:       map[string]string{},
+		}
+		if *image != "" {
+			if q.Image, err = regexp.Compile(*image); err != nil {
+				return usageErrorf("invalid --image regular expression: %v", err)
 			}
-			if filepath.Ext(file.Name()) != ".yaml" && filepath.Ext(file.Name()) != ".yml" || file.Name() == ".global.yaml" {
-				log.Println("skipping", file.Name())
-				return nil
+		}
+		for _, l := range *labels {
+			kv := strings.SplitN(l, "=", 2)
+			if len(kv) == 2 {
+				q.Labels[kv[0]] = kv[1]
+			} else {
+				q.Labels[kv[0]] = ""
 			}
-			jobs := cli.ReadJobsConfig(src)
-			for _, branch := range jobs.Branches {
-				cli.ValidateJobConfig(file.Name(), jobs)
-				output := cli.ConvertJobConfig(jobs, branch)
-				rf := ref{jobs.Org, jobs.Repo, branch}
-				if _, ok := cachedOutput[rf]; !ok {
-					cachedOutput[rf] = output
-				} else {
-					cachedOutput[rf] = combineJobConfigs(cachedOutput[rf], output,
-						fmt.Sprintf("%s/%s", jobs.Org, jobs.Repo))
-				}
+		}
+
+		metaConfigs, err := o.readJobsConfigs(cli)
+		if err != nil {
+			return err
+		}
+		jobs, err := cli.ResolveJobs(metaConfigs)
+		if err != nil {
+			return err
+		}
+		jobs = q.Filter(jobs)
+
+		if *format == "json" {
+			if jobs == nil {
+				jobs = []config.ResolvedJob{}
 			}
+			bs, err := json.MarshalIndent(jobs, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(bs))
 			return nil
-		}); err != nil {
-			exit(err, "walking through the meta config files failed")
-		}
-
-		for r, output := range cachedOutput {
-			fname := GetFileName(r.repo, r.org, r.branch)
-			switch flag.Arg(0) {
-			case "write":
-				cli.WriteConfig(output, fname)
-			case "diff":
-				existing := config.ReadProwJobConfig(fname)
-				cli.DiffConfig(output, existing)
-			default:
-				cli.PrintConfig(output)
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "REPO\tBRANCHES\tNAME\tTYPES\tCLUSTER\tRESOURCES\tREQUIREMENTS\tSCHEDULE")
+		for _, j := range jobs {
+			schedule := j.Job.Cron
+			if j.Job.Interval != "" {
+				schedule = "every " + j.Job.Interval
+			}
+			if !sets.NewString(j.Job.Types...).Has(config.TypePeriodic) {
+				schedule = ""
 			}
+			_, _ = fmt.Fprintf(tw, "%s/%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", j.Org, j.Repo,
+				strings.Join(j.Branches, ","), j.Job.Name, strings.Join(j.Job.Types, ","), j.Job.Cluster,
+				j.Job.Resource, strings.Join(j.Job.Requirements, ","), schedule)
+		}
+		return tw.Flush()
+	}
+}
+
+func setupAffected(fs *flag.FlagSet, o *options) func(args []string) error {
+	o.addFilterFlags(fs, false)
+	return func(args []string) error {
+		if len(args) == 0 {
+			return usageErrorf("must specify the changed files, e.g. pkg/test/util.go")
+		}
+		cli, err := o.client()
+		if err != nil {
+			return err
+		}
+		metaConfigs, err := o.readJobsConfigs(cli)
+		if err != nil {
+			return err
+		}
+		jobs, err := cli.AffectedPresubmits(metaConfigs, args)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "REPO\tBRANCH\tNAME\tREASON")
+		for _, j := range jobs {
+			_, _ = fmt.Fprintf(tw, "%s/%s\t%s\t%s\t%s\n", j.Ref.Org, j.Ref.Repo, j.Ref.Branch, j.Name, j.Reason)
+		}
+		return tw.Flush()
+	}
+}
+
+func setupExplain(fs *flag.FlagSet, o *options) func(args []string) error {
+	o.addFilterFlags(fs, false)
+	return func(args []string) error {
+		if len(args) != 1 {
+			return usageErrorf("must specify the name of the generated job, e.g. unit-tests_istio")
+		}
+		cli, err := o.client()
+		if err != nil {
+			return err
+		}
+		metaConfigs, err := o.readJobsConfigs(cli)
+		if err != nil {
+			return err
+		}
+		e, err := cli.ExplainJob(metaConfigs, args[0])
+		if err != nil {
+			return err
+		}
+		return e.Write(os.Stdout)
+	}
+}
+
+func setupTestgrid(fs *flag.FlagSet, o *options) func(args []string) error {
+	o.addFilterFlags(fs, false)
+	output := fs.String("output", "", "File to write the TestGrid config to, stdout if empty.")
+	return func(args []string) error {
+		if err := noArgs(args); err != nil {
+			return err
+		}
+		cli, err := o.client()
+		if err != nil {
+			return err
+		}
+		metaConfigs, err := o.readJobsConfigs(cli)
+		if err != nil {
+			return err
+		}
+		if err := cli.ValidateJobsConfigs(metaConfigs); err != nil {
+			return fmt.Errorf("validation failed: %v", err)
+		}
+		tg, err := cli.GenerateTestgridConfig(metaConfigs)
+		if err != nil {
+			return err
+		}
+		if *output == "" {
+			return tg.Write(os.Stdout, cli.GlobalConfig.AutogenHeader)
+		}
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
 		}
+		if err := tg.Write(f, cli.GlobalConfig.AutogenHeader); err != nil {
+			_ = f.Close()
+			return err
+		}
+		return f.Close()
+	}
+}
+
+// regenerateFlags are the flags of the commands changing the meta configs, and regenerating all
+// the job configs afterwards.
+type regenerateFlags struct {
+	dryRun     *bool
+	privateDir *string
+	rootDir    *string
+}
+
+func addRegenerateFlags(fs *flag.FlagSet, dryRunUsage string) regenerateFlags {
+	return regenerateFlags{
+		dryRun: fs.Bool("dry-run", false, dryRunUsage),
+		privateDir: fs.String("private-input-dir", "../istio-private_jobs",
+			"Directory of the private transform configs. They are left unchanged if empty."),
+		rootDir: fs.String("root-dir", "../../..", "Root directory of the repository, the private jobs are generated from."),
+	}
+}
+
+// branchFlags are the flags of the commands creating and removing release branches.
+type branchFlags struct {
+	regenerateFlags
+	prowConfig *string
+}
+
+func addBranchFlags(fs *flag.FlagSet, action string) branchFlags {
+	return branchFlags{
+		regenerateFlags: addRegenerateFlags(fs, fmt.Sprintf("Only print the plan of the changes %s the branch.", action)),
+		prowConfig: fs.String("prow-config", "../../config.yaml",
+			"Prow config file with the branch protection. The branch protection is left unchanged if empty."),
+	}
+}
+
+// regenerate regenerates the public and private job configs after the meta configs changed, and
+// checks them.
+func (o *options) regenerate(cli *config.Client, f regenerateFlags) error {
+	if err := o.write(cli, false); err != nil {
+		return err
+	}
+	if *f.privateDir != "" {
+		if err := generatePrivateJobs(*f.rootDir, *f.privateDir); err != nil {
+			return err
+		}
+	}
+	return o.check(cli)
+}
+
+func setupBranch(fs *flag.FlagSet, o *options) func(args []string) error {
+	o.addFilterFlags(fs, false)
+	f := addBranchFlags(fs, "creating")
+	pinDigests := fs.Bool("pin-digests", false, "Refer to the images of the branched meta configs by digest as well as by tag.")
+	return func(args []string) error {
+		if len(args) != 1 {
+			return usageErrorf("must specify the release version, e.g. 1.8")
+		}
+		if o.branch != "" {
+			return usageErrorf("--branch is not supported, only the master meta configs are branched")
+		}
+		cli, err := o.client()
+		if err != nil {
+			return err
+		}
+		metaConfigs, err := o.readJobsConfigs(cli)
+		if err != nil {
+			return err
+		}
+
+		plan, err := cli.PlanBranch(config.BranchOptions{
+			Version:            args[0],
+			MetaConfigDir:      o.inputDir,
+			TransformConfigDir: *f.privateDir,
+			ProwConfig:         *f.prowConfig,
+			PinDigests:         *pinDigests,
+		}, metaConfigs)
+		if err != nil {
+			return err
+		}
+		if err := plan.Write(os.Stdout); err != nil {
+			return err
+		}
+		if *f.dryRun {
+			return nil
+		}
+		if err := plan.Apply(config.NewOCIRegistry()); err != nil {
+			return err
+		}
+		return o.regenerate(cli, f.regenerateFlags)
 	}
 }
 
-func combineJobConfigs(jc1, jc2 k8sProwConfig.JobConfig, orgRepo string) k8sProwConfig.JobConfig {
-	presubmits := jc1.PresubmitsStatic
-	postsubmits := jc1.PostsubmitsStatic
-	periodics := jc1.Periodics
+func setupUnbranch(fs *flag.FlagSet, o *options) func(args []string) error {
+	f := addBranchFlags(fs, "removing")
+	return func(args []string) error {
+		if len(args) != 1 {
+			return usageErrorf("must specify the release version, e.g. 1.7")
+		}
+		cli, err := o.client()
+		if err != nil {
+			return err
+		}
+		metaConfigs, err := o.readJobsConfigs(cli)
+		if err != nil {
+			return err
+		}
 
-	presubmits[orgRepo] = append(presubmits[orgRepo], jc2.PresubmitsStatic[orgRepo]...)
-	postsubmits[orgRepo] = append(postsubmits[orgRepo], jc2.PostsubmitsStatic[orgRepo]...)
-	periodics = append(periodics, jc2.Periodics...)
+		plan, err := cli.PlanUnbranch(config.UnbranchOptions{
+			Version:            args[0],
+			OutputDir:          o.outputDir,
+			TransformConfigDir: *f.privateDir,
+			ProwConfig:         *f.prowConfig,
+		}, metaConfigs)
+		if err != nil {
+			return err
+		}
+		if err := plan.Write(os.Stdout); err != nil {
+			return err
+		}
+		if *f.dryRun {
+			return nil
+		}
+		if err := plan.Apply(); err != nil {
+			return err
+		}
+		return o.regenerate(cli, f.regenerateFlags)
+	}
+}
 
-	return k8sProwConfig.JobConfig{
-		PresubmitsStatic:  presubmits,
-		PostsubmitsStatic: postsubmits,
-		Periodics:         periodics,
+func setupBump(fs *flag.FlagSet, o *options) func(args []string) error {
+	o.addFilterFlags(fs, false)
+	f := addRegenerateFlags(fs, "Only print the images that would be bumped.")
+	tagPattern := fs.String("tag-pattern", config.DefaultImageTagPattern,
+		"Regular expression the new tags must match, with {branch} replaced with the branches of the meta config.")
+	image := fs.String("image", "", "Only bump the images matching this regular expression.")
+	return func(args []string) error {
+		if err := noArgs(args); err != nil {
+			return err
+		}
+		bo := config.BumpOptions{TagPattern: *tagPattern}
+		if *image != "" {
+			re, err := regexp.Compile(*image)
+			if err != nil {
+				return usageErrorf("invalid --image regular expression: %v", err)
+			}
+			bo.Images = re
+		}
+		cli, err := o.client()
+		if err != nil {
+			return err
+		}
+		metaConfigs, err := o.readJobsConfigs(cli)
+		if err != nil {
+			return err
+		}
+
+		plan, err := cli.PlanImageBump(config.NewOCIRegistry(), bo, metaConfigs)
+		if err != nil {
+			return err
+		}
+		if err := plan.Write(os.Stdout); err != nil {
+			return err
+		}
+		if *f.dryRun || len(plan.Bumps) == 0 {
+			return nil
+		}
+		if err := plan.Apply(); err != nil {
+			return err
+		}
+		return o.regenerate(cli, f)
+	}
+}
+
+// generatePrivateJobs generates the private jobs from the transform configs like
+// `make generate-config` does.
+func generatePrivateJobs(rootDir, privateDir string) error {
+	configs, err := filepath.Abs(privateDir)
+	if err != nil {
+		return err
+	}
+	stale, err := filepath.Glob(filepath.Join(rootDir, "prow/cluster/jobs/istio-private/*/*.gen.yaml"))
+	if err != nil {
+		return err
+	}
+	for _, f := range stale {
+		if err := os.Remove(f); err != nil {
+			return err
+		}
+	}
+	cmd := exec.Command("go", "run", "prow/genjobs/main.go", "--configs="+configs)
+	cmd.Dir = rootDir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("generating the private jobs failed: %v", err)
 	}
+	return nil
 }
@@ -0,0 +1,325 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"k8s.io/test-infra/prow/config"
+)
+
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+
+	DiffFormatJSON     = "json"
+	DiffFormatMarkdown = "markdown"
+)
+
+// DiffReport lists the differences between the newly generated and the existing Prow jobs.
+type DiffReport struct {
+	Jobs []JobDiff `json:"jobs"`
+}
+
+// JobDiff describes how a single generated Prow job changed.
+type JobDiff struct {
+	Org    string `json:"org"`
+	Repo   string `json:"repo"`
+	Branch string `json:"branch"`
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Change string `json:"change"`
+	// Fields is only set for changed jobs.
+	Fields []FieldDiff `json:"fields,omitempty"`
+}
+
+// FieldDiff describes a single changed field of a Prow job. Path uses the json field names
+// of the Prow job, e.g. spec.containers[0].env[TEST_SELECT]. List elements that have a unique
+// name are keyed by name, others by their index.
+type FieldDiff struct {
+	Path string      `json:"path"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// DiffJobConfig compares the generated config for org/repo:branch with the existing one and
+// returns the added, removed and changed jobs of every type.
+func DiffJobConfig(org, repo, branch string, result, existing config.JobConfig) ([]JobDiff, error) {
+	newJobs, err := indexJobs(result)
+	if err != nil {
+		return nil, err
+	}
+	oldJobs, err := indexJobs(existing)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []JobDiff
+	for k, n := range newJobs {
+		d := JobDiff{Org: org, Repo: repo, Branch: branch, Type: k.jobType, Name: k.name}
+		o, ok := oldJobs[k]
+		if !ok {
+			d.Change = ChangeAdded
+			diffs = append(diffs, d)
+			continue
+		}
+		fields := diffValues("", o, n)
+		if len(fields) == 0 {
+			continue
+		}
+		d.Change = ChangeChanged
+		d.Fields = fields
+		diffs = append(diffs, d)
+	}
+	for k := range oldJobs {
+		if _, ok := newJobs[k]; !ok {
+			diffs = append(diffs, JobDiff{Org: org, Repo: repo, Branch: branch, Type: k.jobType, Name: k.name, Change: ChangeRemoved})
+		}
+	}
+	sortJobDiffs(diffs)
+	return diffs, nil
+}
+
+// DiffStaleFiles returns the jobs of the stale files under dir, as found by FindStaleFiles, as
+// removed jobs, since no meta config generates them anymore.
+func (cli *Client) DiffStaleFiles(dir string, generated []string) ([]JobDiff, error) {
+	stale, err := cli.FindStaleFiles(dir, generated)
+	if err != nil {
+		return nil, err
+	}
+	var diffs []JobDiff
+	for _, f := range stale {
+		r, ok := refOfFile(f)
+		if !ok {
+			return nil, fmt.Errorf("failed to get the org, repo and branch of %s", f)
+		}
+		existing, err := ReadProwJobConfig(f)
+		if err != nil {
+			return nil, err
+		}
+		removed, err := DiffJobConfig(r.Org, r.Repo, r.Branch, config.JobConfig{}, existing)
+		if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, removed...)
+	}
+	return diffs, nil
+}
+
+// Sort orders the jobs in the report by org, repo, branch, type and name.
+func (r *DiffReport) Sort() {
+	sortJobDiffs(r.Jobs)
+}
+
+// Write writes the report in the given format, one of json or markdown.
+func (r *DiffReport) Write(w io.Writer, format string) error {
+	switch format {
+	case DiffFormatJSON:
+		if r.Jobs == nil {
+			r.Jobs = []JobDiff{}
+		}
+		bs, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal diff report: %v", err)
+		}
+		_, err = fmt.Fprintln(w, string(bs))
+		return err
+	case DiffFormatMarkdown:
+		_, err := io.WriteString(w, r.markdown())
+		return err
+	default:
+		return fmt.Errorf("unknown diff format %q, must be one of %s, %s", format, DiffFormatJSON, DiffFormatMarkdown)
+	}
+}
+
+func (r *DiffReport) markdown() string {
+	var sb strings.Builder
+	sb.WriteString("## Generated Prow job changes\n")
+	if len(r.Jobs) == 0 {
+		sb.WriteString("\nNo changes.\n")
+		return sb.String()
+	}
+	section := ""
+	for _, j := range r.Jobs {
+		if s := fmt.Sprintf("%s/%s@%s", j.Org, j.Repo, j.Branch); s != section {
+			section = s
+			fmt.Fprintf(&sb, "\n### %s\n\n", section)
+		}
+		fmt.Fprintf(&sb, "- **%s** %s `%s`\n", j.Change, j.Type, j.Name)
+		for _, f := range j.Fields {
+			fmt.Fprintf(&sb, "  - `%s`: %s → %s\n", f.Path, markdownValue(f.Old), markdownValue(f.New))
+		}
+	}
+	return sb.String()
+}
+
+func markdownValue(v interface{}) string {
+	if v == nil {
+		return "_unset_"
+	}
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("`%v`", v)
+	}
+	return "`" + string(bs) + "`"
+}
+
+func sortJobDiffs(diffs []JobDiff) {
+	sort.SliceStable(diffs, func(i, j int) bool {
+		a, b := diffs[i], diffs[j]
+		for _, c := range [][2]string{{a.Org, b.Org}, {a.Repo, b.Repo}, {a.Branch, b.Branch}, {a.Type, b.Type}, {a.Name, b.Name}} {
+			if c[0] != c[1] {
+				return c[0] < c[1]
+			}
+		}
+		return false
+	})
+}
+
+type jobKey struct {
+	jobType string
+	name    string
+}
+
+// indexJobs converts every job in the config to its generic json representation, so that the
+// generated and the existing jobs are compared the same way they are serialized.
+func indexJobs(c config.JobConfig) (map[jobKey]interface{}, error) {
+	res := map[jobKey]interface{}{}
+	add := func(t, name string, job interface{}) error {
+		bs, err := json.Marshal(job)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s %s: %v", t, name, err)
+		}
+		var v interface{}
+		if err := json.Unmarshal(bs, &v); err != nil {
+			return fmt.Errorf("failed to unmarshal %s %s: %v", t, name, err)
+		}
+		res[jobKey{t, name}] = v
+		return nil
+	}
+	for _, jobs := range c.PresubmitsStatic {
+		for _, job := range jobs {
+			if err := add(TypePresubmit, job.Name, job); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, jobs := range c.PostsubmitsStatic {
+		for _, job := range jobs {
+			if err := add(TypePostsubmit, job.Name, job); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, job := range c.Periodics {
+		if err := add(TypePeriodic, job.Name, job); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func diffValues(path string, o, n interface{}) []FieldDiff {
+	if reflect.DeepEqual(o, n) {
+		return nil
+	}
+	switch ov := o.(type) {
+	case map[string]interface{}:
+		nv, ok := n.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := unionKeys(ov, nv)
+		var res []FieldDiff
+		for _, k := range keys {
+			res = append(res, diffValues(joinPath(path, k), ov[k], nv[k])...)
+		}
+		return res
+	case []interface{}:
+		nv, ok := n.([]interface{})
+		if !ok {
+			break
+		}
+		oNamed, oOK := namedElements(ov)
+		nNamed, nOK := namedElements(nv)
+		var res []FieldDiff
+		if oOK && nOK {
+			for _, k := range unionKeys(oNamed, nNamed) {
+				res = append(res, diffValues(fmt.Sprintf("%s[%s]", path, k), oNamed[k], nNamed[k])...)
+			}
+			return res
+		}
+		for i := 0; i < len(ov) || i < len(nv); i++ {
+			var oe, ne interface{}
+			if i < len(ov) {
+				oe = ov[i]
+			}
+			if i < len(nv) {
+				ne = nv[i]
+			}
+			res = append(res, diffValues(fmt.Sprintf("%s[%d]", path, i), oe, ne)...)
+		}
+		return res
+	}
+	return []FieldDiff{{Path: path, Old: o, New: n}}
+}
+
+// namedElements indexes the list elements by their name field, if all of them have a unique one.
+func namedElements(lst []interface{}) (map[string]interface{}, bool) {
+	res := make(map[string]interface{}, len(lst))
+	for _, e := range lst {
+		m, ok := e.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		name, ok := m["name"].(string)
+		if !ok || name == "" {
+			return nil, false
+		}
+		if _, dup := res[name]; dup {
+			return nil, false
+		}
+		res[name] = e
+	}
+	return res, true
+}
+
+// unionKeys returns the sorted union of the keys of both maps.
+func unionKeys(a, b map[string]interface{}) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,136 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/test-infra/prow/config"
+)
+
+func testJobBase(name string, env ...v1.EnvVar) config.JobBase {
+	return config.JobBase{
+		Name: name,
+		Spec: &v1.PodSpec{
+			Containers: []v1.Container{{Image: "foo", Env: env}},
+		},
+	}
+}
+
+func TestDiffJobConfig(t *testing.T) {
+	existing := config.JobConfig{
+		PresubmitsStatic: map[string][]config.Presubmit{
+			"istio/istio": {
+				{JobBase: testJobBase("unit_istio", v1.EnvVar{Name: "TEST_SELECT", Value: "a"}, v1.EnvVar{Name: "FOO", Value: "foo"})},
+				{JobBase: testJobBase("lint_istio")},
+			},
+		},
+		Periodics: []config.Periodic{
+			{JobBase: testJobBase("nightly_istio_periodic"), Cron: "0 2 * * *"},
+		},
+	}
+	result := config.JobConfig{
+		PresubmitsStatic: map[string][]config.Presubmit{
+			"istio/istio": {
+				{JobBase: testJobBase("unit_istio", v1.EnvVar{Name: "FOO", Value: "foo"}, v1.EnvVar{Name: "TEST_SELECT", Value: "b"})},
+			},
+		},
+		PostsubmitsStatic: map[string][]config.Postsubmit{
+			"istio/istio": {
+				{JobBase: testJobBase("unit_istio_postsubmit")},
+			},
+		},
+		Periodics: []config.Periodic{
+			{JobBase: testJobBase("nightly_istio_periodic"), Cron: "0 3 * * *"},
+		},
+	}
+
+	actual, err := DiffJobConfig("istio", "istio", "master", result, existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []JobDiff{
+		{
+			Org: "istio", Repo: "istio", Branch: "master", Type: TypePeriodic, Name: "nightly_istio_periodic", Change: ChangeChanged,
+			Fields: []FieldDiff{{Path: "cron", Old: "0 2 * * *", New: "0 3 * * *"}},
+		},
+		{Org: "istio", Repo: "istio", Branch: "master", Type: TypePostsubmit, Name: "unit_istio_postsubmit", Change: ChangeAdded},
+		{Org: "istio", Repo: "istio", Branch: "master", Type: TypePresubmit, Name: "lint_istio", Change: ChangeRemoved},
+		{
+			Org: "istio", Repo: "istio", Branch: "master", Type: TypePresubmit, Name: "unit_istio", Change: ChangeChanged,
+			Fields: []FieldDiff{{Path: "spec.containers[0].env[TEST_SELECT].value", Old: "a", New: "b"}},
+		},
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("diff does not match; actual: %+v\n expected %+v\n", actual, expected)
+	}
+
+	report := &DiffReport{Jobs: actual}
+	var out bytes.Buffer
+	if err := report.Write(&out, DiffFormatMarkdown); err != nil {
+		t.Fatal(err)
+	}
+	expectedMarkdown := "## Generated Prow job changes\n\n" +
+		"### istio/istio@master\n\n" +
+		"- **changed** periodic `nightly_istio_periodic`\n" +
+		"  - `cron`: `\"0 2 * * *\"` → `\"0 3 * * *\"`\n" +
+		"- **added** postsubmit `unit_istio_postsubmit`\n" +
+		"- **removed** presubmit `lint_istio`\n" +
+		"- **changed** presubmit `unit_istio`\n" +
+		"  - `spec.containers[0].env[TEST_SELECT].value`: `\"a\"` → `\"b\"`\n"
+	if out.String() != expectedMarkdown {
+		t.Errorf("markdown report does not match; actual:\n%s\nexpected:\n%s", out.String(), expectedMarkdown)
+	}
+}
+
+func TestDiffStaleFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "generated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cli := &Client{GlobalConfig: GlobalConfig{AutogenHeader: DefaultAutogenHeader + "\n"}}
+	writeTestFiles(t, dir, map[string]string{
+		"istio/istio/istio.istio.master.gen.yaml": DefaultAutogenHeader + "\npresubmits: {}\n",
+		"istio/istio.io/istio.istio.io.release-1.0.gen.yaml": DefaultAutogenHeader + `
+postsubmits:
+  istio/istio.io:
+  - name: doc-tests_istio.io_release-1.0_postsubmit
+presubmits:
+  istio/istio.io:
+  - name: lint_istio.io_release-1.0
+`,
+	})
+	generated := []string{filepath.Join(dir, "istio/istio/istio.istio.master.gen.yaml")}
+
+	actual, err := cli.DiffStaleFiles(dir, generated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []JobDiff{
+		{Org: "istio", Repo: "istio.io", Branch: "release-1.0", Type: TypePostsubmit, Name: "doc-tests_istio.io_release-1.0_postsubmit", Change: ChangeRemoved},
+		{Org: "istio", Repo: "istio.io", Branch: "release-1.0", Type: TypePresubmit, Name: "lint_istio.io_release-1.0", Change: ChangeRemoved},
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("diff does not match; actual: %+v\n expected %+v\n", actual, expected)
+	}
+}
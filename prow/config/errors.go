@@ -0,0 +1,56 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidationError describes a single invalid setting found in a meta-config file.
+type ValidationError struct {
+	// File is the meta-config file the error was found in, if known.
+	File string
+	// Job is the name of the offending job. It is empty for file level errors.
+	Job string
+	// Field is the meta-config field that failed validation.
+	Field string
+	// Message describes the problem.
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	var parts []string
+	if e.File != "" {
+		parts = append(parts, e.File)
+	}
+	if e.Job != "" {
+		parts = append(parts, fmt.Sprintf("job %q", e.Job))
+	}
+	if e.Field != "" {
+		parts = append(parts, e.Field)
+	}
+	parts = append(parts, e.Message)
+	return strings.Join(parts, ": ")
+}
+
+func newValidationError(file, job, field, format string, args ...interface{}) *ValidationError {
+	return &ValidationError{
+		File:    file,
+		Job:     job,
+		Field:   field,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
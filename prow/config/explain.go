@@ -0,0 +1,234 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/test-infra/prow/config"
+)
+
+// Layer is a level of the inheritance chain of a job, with the settings configured at that level.
+type Layer struct {
+	// Source describes where the settings are configured, e.g. the meta config file or a template.
+	Source   string
+	Settings map[string]interface{}
+}
+
+// Explanation describes how a generated Prow job is resolved from the meta configs.
+type Explanation struct {
+	Name string
+	Type string
+	Ref  Ref
+	// File, Job and Matrix identify the meta config job the Prow job is generated from.
+	File   string
+	Job    string
+	Matrix map[string]string
+	// Chain holds the layers the job inherits its settings from. The settings of the later layers
+	// override the ones of the earlier layers.
+	Chain []Layer
+	// Requirements are the requirements of the job, including the ones required by them.
+	Requirements []string
+	// Generated is the generated Prow job.
+	Generated interface{}
+}
+
+// ExplainJob returns how the generated Prow job with the given name is resolved from the meta
+// configs. The meta config file of the job is read again for the templates, which are already
+// resolved in the meta configs.
+func (cli *Client) ExplainJob(metaConfigs []MetaConfig, name string) (*Explanation, error) {
+	for _, mc := range metaConfigs {
+		jobs := mc.JobsConfig
+		for _, branch := range jobs.Branches {
+			jc, err := cli.ConvertJobConfig(jobs, branch)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", mc.Path, err)
+			}
+			jobType, jobBase, generated := findJob(jc, name)
+			if generated == nil {
+				continue
+			}
+			e := &Explanation{
+				Name:      name,
+				Type:      jobType,
+				Ref:       Ref{Org: jobs.Org, Repo: jobs.Repo, Branch: branch},
+				File:      jobBase.Annotations[SourceFileAnnotation],
+				Job:       jobBase.Annotations[SourceJobAnnotation],
+				Generated: generated,
+			}
+			if err := cli.explainChain(e, mc, jobBase.Annotations[SourceMatrixAnnotation]); err != nil {
+				return nil, err
+			}
+			return e, nil
+		}
+	}
+	return nil, fmt.Errorf("no meta config generates the job %s", name)
+}
+
+// explainChain fills in the inheritance chain, matrix values and requirements of the job expanded
+// with the given matrix values.
+func (cli *Client) explainChain(e *Explanation, mc MetaConfig, matrix string) error {
+	yamlFile, err := ioutil.ReadFile(mc.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", mc.Path, err)
+	}
+	raw := JobsConfig{}
+	if err := yaml.Unmarshal(yamlFile, &raw); err != nil {
+		return fmt.Errorf("failed to unmarshal %s: %v", mc.Path, err)
+	}
+
+	global, err := layer(GlobalConfigFile, cli.GlobalConfig, "autogen_header", "resources", "requirement_presets")
+	if err != nil {
+		return err
+	}
+	file, err := layer(e.File, raw, "jobs", "templates", "resources", "requirement_presets")
+	if err != nil {
+		return err
+	}
+	e.Chain = []Layer{global, file}
+
+	var job *Job
+	for i := range raw.Jobs {
+		if raw.Jobs[i].Name == e.Job {
+			job = &raw.Jobs[i]
+		}
+	}
+	if job == nil {
+		return fmt.Errorf("%s: job %q not found", mc.Path, e.Job)
+	}
+	// The templates are listed from the one extended last, as it is overridden by the others.
+	var templates []Layer
+	for t, seen := job.Extends, []string{}; t != "" && !contains(seen, t); {
+		seen = append(seen, t)
+		template, ok := raw.Templates[t]
+		if !ok {
+			return fmt.Errorf("%s: unknown template %q", mc.Path, t)
+		}
+		l, err := layer(fmt.Sprintf("template %q", t), template, "extends")
+		if err != nil {
+			return err
+		}
+		templates = append([]Layer{l}, templates...)
+		t = template.Extends
+	}
+	e.Chain = append(e.Chain, templates...)
+	l, err := layer(fmt.Sprintf("job %q", job.Name), *job, "extends")
+	if err != nil {
+		return err
+	}
+	e.Chain = append(e.Chain, l)
+
+	// The requirements are the ones of the resolved job expanded with the same matrix values.
+	for _, parentJob := range mc.JobsConfig.Jobs {
+		if parentJob.Name != e.Job {
+			continue
+		}
+		expandedJobs, combs, err := applyMatrixJob(parentJob, mc.JobsConfig.Matrix)
+		if err != nil {
+			return err
+		}
+		for i, expanded := range expandedJobs {
+			if len(combs[i]) > 0 && formatMatrixValues(combs[i]) != matrix {
+				continue
+			}
+			e.Matrix = combs[i]
+			e.Requirements, err = expandRequirements(expanded.Requirements, mc.JobsConfig.RequirementPresets)
+			return err
+		}
+	}
+	return nil
+}
+
+// layer returns the layer of the settings set in v, leaving out the ignored fields.
+func layer(source string, v interface{}, ignored ...string) (Layer, error) {
+	settings := map[string]interface{}{}
+	if err := convertFields(v, &settings); err != nil {
+		return Layer{}, fmt.Errorf("failed to convert the settings of %s: %v", source, err)
+	}
+	for _, f := range ignored {
+		delete(settings, f)
+	}
+	return Layer{Source: source, Settings: settings}, nil
+}
+
+// findJob returns the type, job base and job of the generated job with the given name.
+func findJob(jc config.JobConfig, name string) (string, config.JobBase, interface{}) {
+	for _, jobs := range jc.PresubmitsStatic {
+		for _, job := range jobs {
+			if job.Name == name {
+				return TypePresubmit, job.JobBase, job
+			}
+		}
+	}
+	for _, jobs := range jc.PostsubmitsStatic {
+		for _, job := range jobs {
+			if job.Name == name {
+				return TypePostsubmit, job.JobBase, job
+			}
+		}
+	}
+	for _, job := range jc.Periodics {
+		if job.Name == name {
+			return TypePeriodic, job.JobBase, job
+		}
+	}
+	return "", config.JobBase{}, nil
+}
+
+// Write writes the explanation in a human readable form.
+func (e *Explanation) Write(w io.Writer) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s (%s)\n", e.Type, e.Name, e.Ref)
+	fmt.Fprintf(&sb, "generated from %s job %q", e.File, e.Job)
+	if len(e.Matrix) > 0 {
+		fmt.Fprintf(&sb, " with matrix values %s", formatMatrixValues(e.Matrix))
+	}
+	sb.WriteString("\n\ninheritance chain, the later settings override the earlier ones:\n")
+	for _, l := range e.Chain {
+		fmt.Fprintf(&sb, "- %s:", l.Source)
+		if len(l.Settings) == 0 {
+			sb.WriteString(" no settings\n")
+			continue
+		}
+		bs, err := yaml.Marshal(l.Settings)
+		if err != nil {
+			return fmt.Errorf("failed to marshal the settings of %s: %v", l.Source, err)
+		}
+		sb.WriteString("\n" + indent(string(bs), "    "))
+	}
+	fmt.Fprintf(&sb, "\nrequirements: %s\n", strings.Join(e.Requirements, ", "))
+
+	bs, err := yaml.Marshal(e.Generated)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job %s: %v", e.Name, err)
+	}
+	sb.WriteString("\ngenerated job:\n" + indent(string(bs), "  "))
+	_, err = io.WriteString(w, sb.String())
+	return err
+}
+
+func indent(s, prefix string) string {
+	lines := strings.SplitAfter(s, "\n")
+	for i, l := range lines {
+		if l != "" {
+			lines[i] = prefix + l
+		}
+	}
+	return strings.Join(lines, "")
+}
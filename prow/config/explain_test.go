@@ -0,0 +1,96 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExplainJob(t *testing.T) {
+	settings, err := ReadGlobalSettings("testdata/.global.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli := &Client{GlobalConfig: settings}
+	var metaConfigs []MetaConfig
+	for _, f := range []string{"testdata/templates.yaml", "testdata/simple-matrix.yaml"} {
+		jobs, err := cli.ReadJobsConfig(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		metaConfigs = append(metaConfigs, MetaConfig{Path: f, JobsConfig: jobs})
+	}
+
+	testCases := []struct {
+		name         string
+		job          string
+		expectedType string
+		expectedFile string
+		expectedJob  string
+		matrix       map[string]string
+		chain        []string
+		requirements []string
+	}{
+		{
+			name:         "templates",
+			job:          "integ-multicluster-k8s-tests_istio_postsubmit",
+			expectedType: TypePostsubmit,
+			expectedFile: "templates.yaml",
+			expectedJob:  "integ-multicluster-k8s-tests",
+			chain:        []string{".global.yaml", "templates.yaml", `template "kind"`, `template "kind-multicluster"`, `job "integ-multicluster-k8s-tests"`},
+			requirements: []string{"cache", "kind"},
+		},
+		{
+			name:         "matrix",
+			job:          "test-gcloud-arg2-val1_istio",
+			expectedType: TypePresubmit,
+			expectedFile: "simple-matrix.yaml",
+			expectedJob:  "test-$(matrix.requirement)-$(matrix.command-arg)-$(matrix.env-val)",
+			matrix:       map[string]string{"command-arg": "arg2", "requirement": "gcloud", "env-val": "val1"},
+			chain:        []string{".global.yaml", "simple-matrix.yaml", `job "test-$(matrix.requirement)-$(matrix.command-arg)-$(matrix.env-val)"`},
+			requirements: []string{"cache", "gcloud"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e, err := cli.ExplainJob(metaConfigs, tc.job)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e.Type != tc.expectedType || e.File != tc.expectedFile || e.Job != tc.expectedJob {
+				t.Errorf("source does not match; actual: %s %s %q\n expected %s %s %q\n",
+					e.Type, e.File, e.Job, tc.expectedType, tc.expectedFile, tc.expectedJob)
+			}
+			if !reflect.DeepEqual(tc.matrix, e.Matrix) {
+				t.Errorf("matrix values do not match; actual: %v\n expected %v\n", e.Matrix, tc.matrix)
+			}
+			var chain []string
+			for _, l := range e.Chain {
+				chain = append(chain, l.Source)
+			}
+			if !reflect.DeepEqual(tc.chain, chain) {
+				t.Errorf("chain does not match; actual: %v\n expected %v\n", chain, tc.chain)
+			}
+			if !reflect.DeepEqual(tc.requirements, e.Requirements) {
+				t.Errorf("requirements do not match; actual: %v\n expected %v\n", e.Requirements, tc.requirements)
+			}
+		})
+	}
+
+	if _, err := cli.ExplainJob(metaConfigs, "unknown_istio"); err == nil {
+		t.Error("expected an error for an unknown job")
+	}
+}
@@ -27,7 +27,6 @@ import (
 
 	"github.com/ghodss/yaml"
 	"github.com/hashicorp/go-multierror"
-	"github.com/kr/pretty"
 	"gopkg.in/robfig/cron.v2"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
@@ -36,24 +35,27 @@ import (
 	"k8s.io/test-infra/prow/gerrit/client"
 )
 
-func exit(err error, context string) {
-	if context == "" {
-		_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
-	} else {
-		_, _ = fmt.Fprintf(os.Stderr, "%v: %v\n", context, err)
-	}
-	os.Exit(1)
-}
-
 const (
-	TestGridDashboard   = "testgrid-dashboards"
-	TestGridAlertEmail  = "testgrid-alert-email"
-	TestGridNumFailures = "testgrid-num-failures-to-alert"
+	TestGridDashboard              = "testgrid-dashboards"
+	TestGridTabName                = "testgrid-tab-name"
+	TestGridDescription            = "description"
+	TestGridAlertEmail             = "testgrid-alert-email"
+	TestGridNumFailures            = "testgrid-num-failures-to-alert"
+	TestGridAlertStaleResultsHours = "testgrid-alert-stale-results-hours"
+
+	// The annotations recording the meta config file, job and matrix values a job is generated from.
+	SourceFileAnnotation   = "meta-config-file"
+	SourceJobAnnotation    = "meta-config-job"
+	SourceMatrixAnnotation = "meta-config-matrix"
 
 	DefaultAutogenHeader = "# THIS FILE IS AUTOGENERATED, DO NOT EDIT IT MANUALLY."
 
 	DefaultResource = "default"
 
+	// TestContainerName is the name of the container running the job command, set when the job
+	// has sidecars.
+	TestContainerName = "test"
+
 	ModifierHidden   = "hidden"
 	ModifierOptional = "optional"
 	ModifierSkipped  = "skipped"
@@ -74,6 +76,14 @@ type Client struct {
 type GlobalConfig struct {
 	AutogenHeader string `json:"autogen_header,omitempty"`
 
+	// JobNameTemplate is the Go template generating the job names from JobNameVars,
+	// DefaultJobNameTemplate if not set.
+	JobNameTemplate string `json:"job_name_template,omitempty"`
+	// DefaultBranch is the default branch of the repos, DefaultBranch if not set. The jobs of the
+	// default branch are generated for the meta configs not setting the branches, and their names do
+	// not include the branch by default.
+	DefaultBranch string `json:"default_branch,omitempty"`
+
 	PathAliases map[string]string `json:"path_aliases,omitempty"`
 
 	GCSLogBucket                  string `json:"gcs_log_bucket,omitempty"`
@@ -81,32 +91,61 @@ type GlobalConfig struct {
 
 	Cluster      string            `json:"cluster,omitempty"`
 	NodeSelector map[string]string `json:"node_selector,omitempty"`
+	// Clusters are the build clusters the jobs can run in besides the default one. Any cluster is
+	// allowed if it is empty.
+	Clusters []string `json:"clusters,omitempty"`
+
+	Tolerations               []v1.Toleration               `json:"tolerations,omitempty"`
+	Affinity                  *v1.Affinity                  `json:"affinity,omitempty"`
+	TopologySpreadConstraints []v1.TopologySpreadConstraint `json:"topology_spread_constraints,omitempty"`
+	PriorityClassName         string                        `json:"priority_class_name,omitempty"`
+
+	SecurityContext    *v1.SecurityContext    `json:"security_context,omitempty"`
+	PodSecurityContext *v1.PodSecurityContext `json:"pod_security_context,omitempty"`
 
 	TestgridConfig TestgridConfig `json:"testgrid_config,omitempty"`
 
 	Annotations map[string]string `json:"annotations,omitempty"`
 	Labels      map[string]string `json:"labels,omitempty"`
 
+	Env []v1.EnvVar `json:"env,omitempty"`
+
 	ResourcePresets    map[string]v1.ResourceRequirements `json:"resources,omitempty"`
 	BaseRequirements   []string                           `json:"base_requirements,omitempty"`
 	RequirementPresets map[string]RequirementPreset       `json:"requirement_presets,omitempty"`
 }
 
 type TestgridConfig struct {
-	Enabled            bool   `json:"enabled,omitempty"`
-	AlertEmail         string `json:"alert_email,omitempty"`
-	NumFailuresToAlert string `json:"num_failures_to_alert,omitempty"`
+	Enabled                bool   `json:"enabled,omitempty"`
+	AlertEmail             string `json:"alert_email,omitempty"`
+	NumFailuresToAlert     string `json:"num_failures_to_alert,omitempty"`
+	AlertStaleResultsHours string `json:"alert_stale_results_hours,omitempty"`
+	// GCSBucket is the bucket of the job logs the test groups of the standalone testgrid config
+	// read, unless the job sets its own.
+	GCSBucket string `json:"gcs_bucket,omitempty"`
 }
 
 type JobsConfig struct {
+	// File is the name of the meta config file the config is read from. It is recorded on the
+	// generated jobs, and not part of the meta config.
+	File string `json:"-"`
+
 	Jobs []Job `json:"jobs,omitempty"`
 
 	Repo     string   `json:"repo,omitempty"`
 	Org      string   `json:"org,omitempty"`
 	Branches []string `json:"branches,omitempty"`
-	CloneURI string   `json:"clone_uri,omitempty"`
+	// DefaultBranch is the default branch of the repo, the one of the global config if not set.
+	DefaultBranch string `json:"default_branch,omitempty"`
+	// CloneURI is the URI the repo is cloned from instead of GitHub, e.g. for a mirror.
+	CloneURI string `json:"clone_uri,omitempty"`
+	// Gerrit makes the jobs run for the changes of a Gerrit project instead of a GitHub repo.
+	Gerrit *GerritConfig `json:"gerrit,omitempty"`
 
-	Matrix map[string][]string `json:"matrix,omitempty"`
+	Matrix *Matrix `json:"matrix,omitempty"`
+
+	// Templates are the named job settings the jobs can extend.
+	Templates map[string]Job `json:"templates,omitempty"`
 
 	Env                     []v1.EnvVar `json:"env,omitempty"`
 	Image                   string      `json:"image,omitempty"`
@@ -122,9 +161,20 @@ type JobsConfig struct {
 	Cluster      string            `json:"cluster,omitempty"`
 	NodeSelector map[string]string `json:"node_selector,omitempty"`
 
+	Tolerations               []v1.Toleration               `json:"tolerations,omitempty"`
+	Affinity                  *v1.Affinity                  `json:"affinity,omitempty"`
+	TopologySpreadConstraints []v1.TopologySpreadConstraint `json:"topology_spread_constraints,omitempty"`
+	PriorityClassName         string                        `json:"priority_class_name,omitempty"`
+
+	SecurityContext    *v1.SecurityContext    `json:"security_context,omitempty"`
+	PodSecurityContext *v1.PodSecurityContext `json:"pod_security_context,omitempty"`
+
 	Annotations map[string]string `json:"annotations,omitempty"`
 	Labels      map[string]string `json:"labels,omitempty"`
 
+	// Testgrid configures the testgrid tabs of all the jobs.
+	Testgrid *JobTestgridConfig `json:"testgrid,omitempty"`
+
 	Trigger string `json:"trigger,omitempty"`
 
 	ResourcePresets    map[string]v1.ResourceRequirements `json:"resources,omitempty"`
@@ -133,7 +183,13 @@ type JobsConfig struct {
 }
 
 type Job struct {
-	Name           string                  `json:"name,omitempty"`
+	// Extends is the name of the template the job inherits the fields it does not set from.
+	Extends string `json:"extends,omitempty"`
+
+	Name string `json:"name,omitempty"`
+	// AllowLongName skips the MaxJobNameLength check of the generated names, for the jobs of the
+	// released branches keeping their names. Prow truncates the names used as label values.
+	AllowLongName  bool                    `json:"allow_long_name,omitempty"`
 	Command        []string                `json:"command,omitempty"`
 	Types          []string                `json:"types,omitempty"`
 	Timeout        *prowjob.Duration       `json:"timeout,omitempty"`
@@ -142,6 +198,12 @@ type Job struct {
 	MaxConcurrency int                     `json:"max_concurrency,omitempty"`
 	ReporterConfig *prowjob.ReporterConfig `json:"reporter_config,omitempty"`
 
+	// RunIfChangedPaths are the path globs of the files triggering the job when changed, see
+	// GlobsToRegex. SkipIfOnlyChangedPaths are the ones of the files not triggering the job when
+	// only they are changed.
+	RunIfChangedPaths      []string `json:"run_if_changed_paths,omitempty"`
+	SkipIfOnlyChangedPaths []string `json:"skip_if_only_changed_paths,omitempty"`
+
 	Env                     []v1.EnvVar `json:"env,omitempty"`
 	Image                   string      `json:"image,omitempty"`
 	ImagePullPolicy         string      `json:"image_pull_policy,omitempty"`
@@ -156,65 +218,102 @@ type Job struct {
 	Cluster      string            `json:"cluster,omitempty"`
 	NodeSelector map[string]string `json:"node_selector,omitempty"`
 
+	Tolerations               []v1.Toleration               `json:"tolerations,omitempty"`
+	Affinity                  *v1.Affinity                  `json:"affinity,omitempty"`
+	TopologySpreadConstraints []v1.TopologySpreadConstraint `json:"topology_spread_constraints,omitempty"`
+	PriorityClassName         string                        `json:"priority_class_name,omitempty"`
+
+	SecurityContext    *v1.SecurityContext    `json:"security_context,omitempty"`
+	PodSecurityContext *v1.PodSecurityContext `json:"pod_security_context,omitempty"`
+
 	Annotations           map[string]string `json:"annotations,omitempty"`
 	Labels                map[string]string `json:"labels,omitempty"`
 	GerritPresubmitLabel  string            `json:"gerrit_presubmit_label,omitempty"`
 	GerritPostsubmitLabel string            `json:"gerrit_postsubmit_label,omitempty"`
 
+	// Testgrid configures the testgrid tab of the job, overwriting the one of the meta config.
+	Testgrid *JobTestgridConfig `json:"testgrid,omitempty"`
+
 	Trigger string `json:"trigger,omitempty"`
+	// TriggerMode is when the presubmit of the job runs, TriggerModeManual, and for any change
+	// matching regex, run_if_changed_paths and skip_if_only_changed_paths if not set. There is no
+	// label gated mode as Prow cannot trigger presubmits on labels.
+	TriggerMode string `json:"trigger_mode,omitempty"`
 
 	Resource     string   `json:"resources,omitempty"`
 	Modifiers    []string `json:"modifiers,omitempty"`
 	Requirements []string `json:"requirements,omitempty"`
+
+	// Sidecars are the containers running alongside the test container, e.g. a local registry.
+	Sidecars []v1.Container `json:"sidecars,omitempty"`
+	// InitContainers are the containers run before the test container is started.
+	InitContainers []v1.Container `json:"init_containers,omitempty"`
+
+	// Matrix overrides the matrix of the meta config for this job.
+	Matrix *Matrix `json:"matrix,omitempty"`
 }
 
-func ReadGlobalSettings(file string) GlobalConfig {
+// ReadGlobalSettings reads the global config shared by all the meta config files.
+func ReadGlobalSettings(file string) (GlobalConfig, error) {
 	yamlFile, err := ioutil.ReadFile(file)
 	if err != nil {
-		exit(err, "failed to read "+file)
+		return GlobalConfig{}, fmt.Errorf("failed to read %s: %v", file, err)
 	}
 	globalSettings := GlobalConfig{
 		AutogenHeader: DefaultAutogenHeader,
 	}
 	if err := yaml.Unmarshal(yamlFile, &globalSettings); err != nil {
-		exit(err, "failed to unmarshal "+file)
+		return GlobalConfig{}, fmt.Errorf("failed to unmarshal %s: %v", file, err)
+	}
+	if _, err := parseJobNameTemplate(globalSettings.JobNameTemplate); err != nil {
+		return GlobalConfig{}, fmt.Errorf("%s: %v", file, err)
 	}
 
-	return globalSettings
+	return globalSettings, nil
 }
 
 // Reads the jobs yaml
-func (cli *Client) ReadJobsConfig(file string) JobsConfig {
+func (cli *Client) ReadJobsConfig(file string) (JobsConfig, error) {
 	yamlFile, err := ioutil.ReadFile(file)
 	if err != nil {
-		exit(err, "failed to read "+file)
+		return JobsConfig{}, fmt.Errorf("failed to read %s: %v", file, err)
 	}
 	jobsConfig := JobsConfig{}
 	if err := yaml.Unmarshal(yamlFile, &jobsConfig); err != nil {
-		exit(err, "failed to unmarshal "+file)
+		return JobsConfig{}, fmt.Errorf("failed to unmarshal %s: %v", file, err)
 	}
+	jobsConfig.File = filepath.Base(file)
 
 	if len(jobsConfig.Branches) == 0 {
-		jobsConfig.Branches = []string{"master"}
+		jobsConfig.Branches = []string{cli.defaultBranch(jobsConfig)}
 	}
 
-	return resolveOverwrites(cli.GlobalConfig, jobsConfig)
+	jobsConfig, err = resolveTemplates(jobsConfig)
+	if err != nil {
+		if ve, ok := err.(*ValidationError); ok {
+			ve.File = file
+		}
+		return JobsConfig{}, err
+	}
+
+	return resolveOverwrites(cli.GlobalConfig, jobsConfig), nil
 }
 
 func resolveOverwrites(globalConfig GlobalConfig, jobsConfig JobsConfig) JobsConfig {
-	// Resolve globalConfig -> jobsConfig overwriting
-	resources := globalConfig.ResourcePresets
-	if resources == nil {
-		resources = map[string]v1.ResourceRequirements{}
+	// Resolve globalConfig -> jobsConfig overwriting. The global maps are copied since they are
+	// shared by all the meta config files.
+	resources := map[string]v1.ResourceRequirements{}
+	for k, v := range globalConfig.ResourcePresets {
+		resources[k] = v
 	}
 	for k, v := range jobsConfig.ResourcePresets {
 		resources[k] = v
 	}
 	jobsConfig.ResourcePresets = resources
 
-	requirementPresets := globalConfig.RequirementPresets
-	if requirementPresets == nil {
-		requirementPresets = map[string]RequirementPreset{}
+	requirementPresets := map[string]RequirementPreset{}
+	for k, v := range globalConfig.RequirementPresets {
+		requirementPresets[k] = v
 	}
 	for k, v := range jobsConfig.RequirementPresets {
 		requirementPresets[k] = v
@@ -238,6 +337,60 @@ func resolveOverwrites(globalConfig GlobalConfig, jobsConfig JobsConfig) JobsCon
 		}
 		job.NodeSelector = nodeSelector
 
+		tolerations := globalConfig.Tolerations
+		if jobsConfig.Tolerations != nil {
+			tolerations = jobsConfig.Tolerations
+		}
+		if job.Tolerations != nil {
+			tolerations = job.Tolerations
+		}
+		job.Tolerations = tolerations
+
+		affinity := globalConfig.Affinity
+		if jobsConfig.Affinity != nil {
+			affinity = jobsConfig.Affinity
+		}
+		if job.Affinity != nil {
+			affinity = job.Affinity
+		}
+		job.Affinity = affinity
+
+		topologySpreadConstraints := globalConfig.TopologySpreadConstraints
+		if jobsConfig.TopologySpreadConstraints != nil {
+			topologySpreadConstraints = jobsConfig.TopologySpreadConstraints
+		}
+		if job.TopologySpreadConstraints != nil {
+			topologySpreadConstraints = job.TopologySpreadConstraints
+		}
+		job.TopologySpreadConstraints = topologySpreadConstraints
+
+		priorityClassName := globalConfig.PriorityClassName
+		if jobsConfig.PriorityClassName != "" {
+			priorityClassName = jobsConfig.PriorityClassName
+		}
+		if job.PriorityClassName != "" {
+			priorityClassName = job.PriorityClassName
+		}
+		job.PriorityClassName = priorityClassName
+
+		securityContext := globalConfig.SecurityContext
+		if jobsConfig.SecurityContext != nil {
+			securityContext = jobsConfig.SecurityContext
+		}
+		if job.SecurityContext != nil {
+			securityContext = job.SecurityContext
+		}
+		job.SecurityContext = securityContext
+
+		podSecurityContext := globalConfig.PodSecurityContext
+		if jobsConfig.PodSecurityContext != nil {
+			podSecurityContext = jobsConfig.PodSecurityContext
+		}
+		if job.PodSecurityContext != nil {
+			podSecurityContext = job.PodSecurityContext
+		}
+		job.PodSecurityContext = podSecurityContext
+
 		cluster := globalConfig.Cluster
 		if jobsConfig.Cluster != "" {
 			cluster = jobsConfig.Cluster
@@ -311,13 +464,29 @@ func WriteJobConfig(jobsConfig JobsConfig, file string) error {
 	return ioutil.WriteFile(file, bytes, 0644)
 }
 
-func (cli *Client) ValidateJobConfig(fileName string, jobsConfig JobsConfig) {
-	var err error
+// ValidateJobConfig validates the meta config read from fileName. All the problems found are
+// returned together, each of them as a *ValidationError.
+func (cli *Client) ValidateJobConfig(fileName string, jobsConfig JobsConfig) error {
+	var err *multierror.Error
 	if jobsConfig.Org == "" {
-		err = multierror.Append(err, fmt.Errorf("%s: org must be set", fileName))
+		err = multierror.Append(err, newValidationError(fileName, "", "org", "org must be set"))
 	}
 	if jobsConfig.Repo == "" {
-		err = multierror.Append(err, fmt.Errorf("%s: repo must be set", fileName))
+		err = multierror.Append(err, newValidationError(fileName, "", "repo", "repo must be set"))
+	}
+	if jobsConfig.Gerrit != nil {
+		err = multierror.Append(err, validateGerrit(fileName, jobsConfig.Gerrit))
+	}
+	err = multierror.Append(err, validateTestgrid(fileName, "", jobsConfig.Testgrid))
+
+	tmpl, e := parseJobNameTemplate(cli.GlobalConfig.JobNameTemplate)
+	if e != nil {
+		return multierror.Append(err, newValidationError(fileName, "", "job_name_template", "%v", e))
+	}
+	defaultBranch := cli.defaultBranch(jobsConfig)
+	branches := jobsConfig.Branches
+	if len(branches) == 0 {
+		branches = []string{defaultBranch}
 	}
 
 	requirements := make([]string, 0)
@@ -325,62 +494,187 @@ func (cli *Client) ValidateJobConfig(fileName string, jobsConfig JobsConfig) {
 		requirements = append(requirements, name)
 	}
 
-	for _, job := range jobsConfig.Jobs {
-		if job.Image == "" {
-			err = multierror.Append(err, fmt.Errorf("%s: image must be set for job %v", fileName, job.Name))
-		}
-		if job.Resource != "" {
-			if _, f := jobsConfig.ResourcePresets[job.Resource]; !f {
-				err = multierror.Append(err, fmt.Errorf("%s: job '%v' has nonexistant resource '%v'", fileName, job.Name, job.Resource))
-			}
-		}
-		for _, mod := range job.Modifiers {
-			if e := validate(mod, []string{ModifierHidden, ModifierOptional, ModifierSkipped}, "status"); e != nil {
-				err = multierror.Append(err, e)
+	// The generated job names must be unique for each job type.
+	names := map[string]sets.String{}
+	for _, parentJob := range jobsConfig.Jobs {
+		// Validate the jobs expanded from the matrix, since dimensions can be referenced in any field.
+		expandedJobs, combs, e := applyMatrixJob(parentJob, jobsConfig.Matrix)
+		if e != nil {
+			if ve, ok := e.(*ValidationError); ok {
+				ve.File = fileName
 			}
+			err = multierror.Append(err, e)
+			continue
 		}
-		for _, req := range job.Requirements {
-			if e := validate(
-				req,
-				requirements,
-				"requirements"); e != nil {
-				err = multierror.Append(err, e)
+		for i, job := range expandedJobs {
+			err = multierror.Append(err, validateJob(fileName, job, jobsConfig, requirements))
+
+			types := job.Types
+			if len(types) == 0 {
+				types = []string{TypePresubmit, TypePostsubmit}
 			}
-		}
-		if sets.NewString(job.Types...).Has(TypePeriodic) {
-			if job.Cron != "" && job.Interval != "" {
-				err = multierror.Append(err, fmt.Errorf("%s: cron and interval cannot be both set in periodic %s", fileName, job.Name))
-			} else if job.Cron == "" && job.Interval == "" {
-				err = multierror.Append(err, fmt.Errorf("%s: cron and interval cannot be both empty in periodic %s", fileName, job.Name))
-			} else if job.Cron != "" {
-				if _, e := cron.Parse(job.Cron); e != nil {
-					err = multierror.Append(err, fmt.Errorf("%s: invalid cron string %s in periodic %s: %v", fileName, job.Cron, job.Name, e))
+			for _, t := range types {
+				if names[t] == nil {
+					names[t] = sets.NewString()
 				}
-			} else if job.Interval != "" {
-				if _, e := time.ParseDuration(job.Interval); e != nil {
-					err = multierror.Append(err, fmt.Errorf("%s: cannot parse duration %s in periodic %s: %v", fileName, job.Interval, job.Name, e))
+				if names[t].Has(job.Name) {
+					err = multierror.Append(err, newValidationError(fileName, job.Name, "name", "duplicated %s job name", t))
+				}
+				names[t].Insert(job.Name)
+
+				// The generated names are used as label values, which are limited in length.
+				for _, branch := range branches {
+					name, e := jobName(tmpl, JobNameVars{
+						Job: job.Name, Org: jobsConfig.Org, Repo: jobsConfig.Repo, Branch: branch,
+						DefaultBranch: defaultBranch, Type: t, Matrix: combs[i],
+					})
+					if e != nil {
+						err = multierror.Append(err, newValidationError(fileName, job.Name, "name", "%v", e))
+					} else if len(name) > MaxJobNameLength && !job.AllowLongName {
+						err = multierror.Append(err, newValidationError(fileName, job.Name, "name",
+							"generated %s job name %s is longer than %d characters", t, name, MaxJobNameLength))
+					}
 				}
 			}
 		}
-		for _, t := range job.Types {
-			if e := validate(t, []string{TypePostsubmit, TypePresubmit, TypePeriodic}, "type"); e != nil {
-				err = multierror.Append(err, e)
+	}
+	return err.ErrorOrNil()
+}
+
+func validateJob(fileName string, job Job, jobsConfig JobsConfig, requirements []string) error {
+	var err error
+	if job.Image == "" {
+		err = multierror.Append(err, newValidationError(fileName, job.Name, "image", "image must be set"))
+	}
+	if job.Testgrid != nil {
+		err = multierror.Append(err, validateTestgrid(fileName, job.Name, job.Testgrid))
+	}
+	if job.Resource != "" {
+		if _, f := jobsConfig.ResourcePresets[job.Resource]; !f {
+			err = multierror.Append(err, newValidationError(fileName, job.Name, "resources", "nonexistent resource '%v'", job.Resource))
+		}
+	}
+	for _, mod := range job.Modifiers {
+		if e := validate(mod, []string{ModifierHidden, ModifierOptional, ModifierSkipped}, "status"); e != nil {
+			err = multierror.Append(err, newValidationError(fileName, job.Name, "modifiers", "%v", e))
+		}
+	}
+	if e := validateTriggerMode(fileName, job); e != nil {
+		err = multierror.Append(err, e)
+	}
+	for _, req := range job.Requirements {
+		if e := validate(
+			req,
+			requirements,
+			"requirements"); e != nil {
+			err = multierror.Append(err, newValidationError(fileName, job.Name, "requirements", "%v", e))
+		}
+	}
+	// The settings of the requirements are validated together with the ones they require.
+	if reqs, e := expandRequirements(job.Requirements, jobsConfig.RequirementPresets); e != nil {
+		err = multierror.Append(err, newValidationError(fileName, job.Name, "requirements", "%v", e))
+	} else {
+		job.Requirements = reqs
+		for _, c := range requirementConflicts(reqs, jobsConfig.RequirementPresets) {
+			err = multierror.Append(err, newValidationError(fileName, job.Name, "requirements", "%s", c))
+		}
+	}
+	for _, req := range job.Requirements {
+		if r := jobsConfig.RequirementPresets[req].Resource; r != "" {
+			if _, f := jobsConfig.ResourcePresets[r]; !f {
+				err = multierror.Append(err, newValidationError(fileName, job.Name, "requirements", "requirement %s uses nonexistent resource '%v'", req, r))
 			}
 		}
-		for _, repo := range job.Repos {
-			if len(strings.Split(repo, "/")) != 2 {
-				err = multierror.Append(err, fmt.Errorf("%s: repo %v not valid, should take form org/repo", fileName, repo))
+	}
+	if sets.NewString(job.Types...).Has(TypePeriodic) {
+		if job.Cron != "" && job.Interval != "" {
+			err = multierror.Append(err, newValidationError(fileName, job.Name, "cron", "cron and interval cannot be both set in periodic"))
+		} else if job.Cron == "" && job.Interval == "" {
+			err = multierror.Append(err, newValidationError(fileName, job.Name, "cron", "cron and interval cannot be both empty in periodic"))
+		} else if job.Cron != "" {
+			if _, e := cron.Parse(job.Cron); e != nil {
+				err = multierror.Append(err, newValidationError(fileName, job.Name, "cron", "invalid cron string %s: %v", job.Cron, e))
+			}
+		} else if job.Interval != "" {
+			if _, e := time.ParseDuration(job.Interval); e != nil {
+				err = multierror.Append(err, newValidationError(fileName, job.Name, "interval", "cannot parse duration %s: %v", job.Interval, e))
 			}
 		}
 	}
-	if err != nil {
-		exit(err, "validation failed")
+	matchers := 0
+	for _, set := range []bool{job.Regex != "", len(job.RunIfChangedPaths) > 0, len(job.SkipIfOnlyChangedPaths) > 0} {
+		if set {
+			matchers++
+		}
+	}
+	if matchers > 1 {
+		err = multierror.Append(err, newValidationError(fileName, job.Name, "regex",
+			"regex, run_if_changed_paths and skip_if_only_changed_paths are mutually exclusive"))
+	} else if _, e := changeMatcher(jobsConfig, job); e != nil {
+		field := "run_if_changed_paths"
+		if len(job.SkipIfOnlyChangedPaths) > 0 {
+			field = "skip_if_only_changed_paths"
+		}
+		err = multierror.Append(err, newValidationError(fileName, job.Name, field, "%v", e))
 	}
+	for _, t := range job.Types {
+		if e := validate(t, []string{TypePostsubmit, TypePresubmit, TypePeriodic}, "type"); e != nil {
+			err = multierror.Append(err, newValidationError(fileName, job.Name, "types", "%v", e))
+		}
+	}
+	envs := sets.NewString()
+	for _, e := range job.Env {
+		if envs.Has(e.Name) {
+			err = multierror.Append(err, newValidationError(fileName, job.Name, "env", "env %s is set more than once", e.Name))
+		}
+		envs.Insert(e.Name)
+	}
+	// The containers can only run in privileged mode with a requirement granting it, so that it is
+	// explicit why the job needs it.
+	privileged := false
+	for _, req := range job.Requirements {
+		privileged = privileged || jobsConfig.RequirementPresets[req].Privileged
+	}
+	if !privileged {
+		containers := append([]v1.Container{{Name: TestContainerName, SecurityContext: job.SecurityContext}}, job.Sidecars...)
+		for _, c := range append(containers, job.InitContainers...) {
+			if c.SecurityContext != nil && c.SecurityContext.Privileged != nil && *c.SecurityContext.Privileged {
+				err = multierror.Append(err, newValidationError(fileName, job.Name, "security_context",
+					"container %s is privileged without a requirement granting the privileged mode", c.Name))
+			}
+		}
+	}
+
+	containers := sets.NewString(TestContainerName)
+	for _, c := range append(append([]v1.Container{}, job.Sidecars...), job.InitContainers...) {
+		if c.Name == "" {
+			err = multierror.Append(err, newValidationError(fileName, job.Name, "containers", "sidecars and init containers must be named"))
+			continue
+		}
+		if containers.Has(c.Name) {
+			err = multierror.Append(err, newValidationError(fileName, job.Name, "containers", "container name %s is not unique", c.Name))
+		}
+		containers.Insert(c.Name)
+		if c.Image == "" {
+			err = multierror.Append(err, newValidationError(fileName, job.Name, "containers", "image of container %s must be set", c.Name))
+		}
+	}
+	for _, repo := range requiredRepos(job, jobsConfig.RequirementPresets) {
+		if len(strings.Split(repo, "/")) != 2 {
+			err = multierror.Append(err, newValidationError(fileName, job.Name, "repos", "repo %v not valid, should take form org/repo", repo))
+		}
+	}
+	return err
 }
 
-func (cli *Client) ConvertJobConfig(jobsConfig JobsConfig, branch string) config.JobConfig {
+// ConvertJobConfig converts the meta config to the Prow job config for the given branch.
+func (cli *Client) ConvertJobConfig(jobsConfig JobsConfig, branch string) (config.JobConfig, error) {
 	globalConfig := cli.GlobalConfig
-	testgridConfig := globalConfig.TestgridConfig
+	defaultBranch := cli.defaultBranch(jobsConfig)
+	tmpl, err := parseJobNameTemplate(globalConfig.JobNameTemplate)
+	if err != nil {
+		return config.JobConfig{}, err
+	}
 
 	var presubmits []config.Presubmit
 	var postsubmits []config.Postsubmit
@@ -392,83 +686,89 @@ func (cli *Client) ConvertJobConfig(jobsConfig JobsConfig, branch string) config
 		Periodics:         []config.Periodic{},
 	}
 	for _, parentJob := range jobsConfig.Jobs {
-		expandedJobs := applyMatrixJob(parentJob, jobsConfig.Matrix)
-		for _, job := range expandedJobs {
+		expandedJobs, combs, err := applyMatrixJob(parentJob, jobsConfig.Matrix)
+		if err != nil {
+			return config.JobConfig{}, err
+		}
+		for i, job := range expandedJobs {
+			job.Requirements, err = expandRequirements(job.Requirements, jobsConfig.RequirementPresets)
+			if err != nil {
+				return config.JobConfig{}, fmt.Errorf("job %s: %v", job.Name, err)
+			}
+			job.Annotations = mergeMaps(job.Annotations, sourceAnnotations(jobsConfig.File, parentJob.Name, combs[i]))
+
 			brancher := config.Brancher{
 				Branches: []string{fmt.Sprintf("^%s$", branch)},
 			}
+			changes, err := changeMatcher(jobsConfig, job)
+			if err != nil {
+				return config.JobConfig{}, fmt.Errorf("job %s: %v", job.Name, err)
+			}
 
 			testgridJobPrefix := jobsConfig.Org
-			if branch != "master" {
+			if branch != defaultBranch {
 				testgridJobPrefix += "_" + branch
 			}
 			testgridJobPrefix += "_" + jobsConfig.Repo
+			presubmitLabel, postsubmitLabel := jobsConfig.reportLabels(job)
+			testgrid := resolveTestgrid(globalConfig.TestgridConfig, jobsConfig, job)
+			nameVars := JobNameVars{
+				Job: job.Name, Org: jobsConfig.Org, Repo: jobsConfig.Repo, Branch: branch,
+				DefaultBranch: defaultBranch, Matrix: combs[i],
+			}
 
 			if len(job.Types) == 0 || sets.NewString(job.Types...).Has(TypePresubmit) {
-				name := fmt.Sprintf("%s_%s", job.Name, jobsConfig.Repo)
-				if branch != "master" {
-					name += "_" + branch
+				nameVars.Type = TypePresubmit
+				name, err := jobName(tmpl, nameVars)
+				if err != nil {
+					return config.JobConfig{}, err
 				}
 
 				presubmit := config.Presubmit{
-					JobBase:   createJobBase(globalConfig, jobsConfig, job, name, branch, jobsConfig.ResourcePresets),
-					AlwaysRun: true,
-					Brancher:  brancher,
+					JobBase:             createJobBase(globalConfig, jobsConfig, job, name, branch, jobsConfig.ResourcePresets),
+					AlwaysRun:           true,
+					Brancher:            brancher,
+					RegexpChangeMatcher: changes,
 				}
-				if job.GerritPresubmitLabel != "" {
-					presubmit.Labels[client.GerritReportLabel] = job.GerritPresubmitLabel
+				if presubmitLabel != "" {
+					presubmit.Labels[client.GerritReportLabel] = presubmitLabel
 				}
-				if pa, ok := globalConfig.PathAliases[jobsConfig.Org]; ok {
-					presubmit.UtilityConfig.PathAlias = fmt.Sprintf("%s/%s", pa, jobsConfig.Repo)
-				}
-				if job.Regex != "" {
-					presubmit.RegexpChangeMatcher = config.RegexpChangeMatcher{
-						RunIfChanged: job.Regex,
-					}
+				presubmit.UtilityConfig.PathAlias = jobsConfig.pathAlias(globalConfig.PathAliases)
+				presubmit.UtilityConfig.CloneURI = jobsConfig.cloneURI()
+				if presubmit.RegexpChangeMatcher.CouldRun() {
 					presubmit.AlwaysRun = false
 				}
 				if job.Trigger != "" {
 					presubmit.Trigger = job.Trigger
 					presubmit.RerunCommand = job.Trigger
 				}
-				if testgridConfig.Enabled {
-					presubmit.JobBase.Annotations = mergeMaps(presubmit.JobBase.Annotations, map[string]string{
-						TestGridDashboard: testgridJobPrefix,
-					})
+				if testgrid.enabled() {
+					presubmit.JobBase.Annotations = mergeMaps(presubmit.JobBase.Annotations, testgrid.annotations(testgridJobPrefix, false))
 				}
 				applyModifiersPresubmit(&presubmit, job.Modifiers)
+				applyTriggerMode(&presubmit, job)
 				applyRequirements(&presubmit.JobBase, job.Requirements, jobsConfig.RequirementPresets)
 				presubmits = append(presubmits, presubmit)
 			}
 
 			if len(job.Types) == 0 || sets.NewString(job.Types...).Has(TypePostsubmit) {
-				name := fmt.Sprintf("%s_%s", job.Name, jobsConfig.Repo)
-				if branch != "master" {
-					name += "_" + branch
+				nameVars.Type = TypePostsubmit
+				name, err := jobName(tmpl, nameVars)
+				if err != nil {
+					return config.JobConfig{}, err
 				}
-				name += "_postsubmit"
-
 				postsubmit := config.Postsubmit{
-					JobBase:  createJobBase(globalConfig, jobsConfig, job, name, branch, jobsConfig.ResourcePresets),
-					Brancher: brancher,
+					JobBase:             createJobBase(globalConfig, jobsConfig, job, name, branch, jobsConfig.ResourcePresets),
+					Brancher:            brancher,
+					RegexpChangeMatcher: changes,
 				}
-				if job.GerritPostsubmitLabel != "" {
-					postsubmit.Labels[client.GerritReportLabel] = job.GerritPostsubmitLabel
+				if postsubmitLabel != "" {
+					postsubmit.Labels[client.GerritReportLabel] = postsubmitLabel
 				}
-				if pa, ok := globalConfig.PathAliases[jobsConfig.Org]; ok {
-					postsubmit.UtilityConfig.PathAlias = fmt.Sprintf("%s/%s", pa, jobsConfig.Repo)
-				}
-				if job.Regex != "" {
-					postsubmit.RegexpChangeMatcher = config.RegexpChangeMatcher{
-						RunIfChanged: job.Regex,
-					}
-				}
-				if testgridConfig.Enabled {
-					postsubmit.JobBase.Annotations = mergeMaps(postsubmit.JobBase.Annotations, map[string]string{
-						TestGridDashboard:   testgridJobPrefix + "_postsubmit",
-						TestGridAlertEmail:  testgridConfig.AlertEmail,
-						TestGridNumFailures: testgridConfig.NumFailuresToAlert,
-					})
+				postsubmit.UtilityConfig.PathAlias = jobsConfig.pathAlias(globalConfig.PathAliases)
+				postsubmit.UtilityConfig.CloneURI = jobsConfig.cloneURI()
+				if testgrid.enabled() {
+					postsubmit.JobBase.Annotations = mergeMaps(postsubmit.JobBase.Annotations, testgrid.annotations(testgridJobPrefix+"_postsubmit", true))
 				}
 				applyModifiersPostsubmit(&postsubmit, job.Modifiers)
 				applyRequirements(&postsubmit.JobBase, job.Requirements, jobsConfig.RequirementPresets)
@@ -476,12 +776,11 @@ func (cli *Client) ConvertJobConfig(jobsConfig JobsConfig, branch string) config
 			}
 
 			if sets.NewString(job.Types...).Has(TypePeriodic) {
-				name := fmt.Sprintf("%s_%s", job.Name, jobsConfig.Repo)
-				if branch != "master" {
-					name += "_" + branch
+				nameVars.Type = TypePeriodic
+				name, err := jobName(tmpl, nameVars)
+				if err != nil {
+					return config.JobConfig{}, err
 				}
-				name += "_periodic"
-
 				// For periodic jobs, the repo needs to be added to the clonerefs and its root directory
 				// should be set as the working directory, so add itself to the repo list here.
 				job.Repos = append([]string{jobsConfig.Org + "/" + jobsConfig.Repo}, job.Repos...)
@@ -490,12 +789,16 @@ func (cli *Client) ConvertJobConfig(jobsConfig JobsConfig, branch string) config
 					Interval: job.Interval,
 					Cron:     job.Cron,
 				}
-				if testgridConfig.Enabled {
-					periodic.JobBase.Annotations = mergeMaps(periodic.JobBase.Annotations, map[string]string{
-						TestGridDashboard:   testgridJobPrefix + "_periodic",
-						TestGridAlertEmail:  testgridConfig.AlertEmail,
-						TestGridNumFailures: testgridConfig.NumFailuresToAlert,
-					})
+				self := &periodic.UtilityConfig.ExtraRefs[0]
+				if jobsConfig.Gerrit != nil {
+					self.Org, self.Repo = jobsConfig.Gerrit.host(), jobsConfig.gerritProject()
+				}
+				self.PathAlias = jobsConfig.pathAlias(globalConfig.PathAliases)
+				if uri := jobsConfig.cloneURI(); uri != "" {
+					self.CloneURI = uri
+				}
+				if testgrid.enabled() {
+					periodic.JobBase.Annotations = mergeMaps(periodic.JobBase.Annotations, testgrid.annotations(testgridJobPrefix+"_periodic", true))
 				}
 				applyRequirements(&periodic.JobBase, job.Requirements, jobsConfig.RequirementPresets)
 				periodics = append(periodics, periodic)
@@ -503,16 +806,16 @@ func (cli *Client) ConvertJobConfig(jobsConfig JobsConfig, branch string) config
 		}
 
 		if len(presubmits) > 0 {
-			output.PresubmitsStatic[fmt.Sprintf("%s/%s", jobsConfig.Org, jobsConfig.Repo)] = presubmits
+			output.PresubmitsStatic[jobsConfig.repoKey()] = presubmits
 		}
 		if len(postsubmits) > 0 {
-			output.PostsubmitsStatic[fmt.Sprintf("%s/%s", jobsConfig.Org, jobsConfig.Repo)] = postsubmits
+			output.PostsubmitsStatic[jobsConfig.repoKey()] = postsubmits
 		}
 		if len(periodics) > 0 {
 			output.Periodics = periodics
 		}
 	}
-	return output
+	return output, nil
 }
 
 func (cli *Client) CheckConfig(jobs config.JobConfig, currentConfigFile string) error {
@@ -534,29 +837,101 @@ func (cli *Client) CheckConfig(jobs config.JobConfig, currentConfigFile string)
 	return nil
 }
 
-func (cli *Client) WriteConfig(jobs config.JobConfig, fname string) {
+// FindGeneratedFiles returns all the files under dir that were written by WriteConfig. They are
+// recognized by their .gen.yaml extension and the autogen header.
+func (cli *Client) FindGeneratedFiles(dir string) ([]string, error) {
+	header := []byte(cli.GlobalConfig.AutogenHeader)
+	if len(header) == 0 {
+		return nil, errors.New("autogen header is not set, cannot recognize generated files")
+	}
+	var files []string
+	err := filepath.Walk(dir, func(src string, file os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".gen.yaml") {
+			return nil
+		}
+		content, err := ioutil.ReadFile(src)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", src, err)
+		}
+		if bytes.HasPrefix(content, header) {
+			files = append(files, src)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// FindStaleFiles returns the files under dir written by WriteConfig that are not in the list of
+// generated files, i.e. the files whose meta config does not exist anymore.
+func (cli *Client) FindStaleFiles(dir string, generated []string) ([]string, error) {
+	existing, err := cli.FindGeneratedFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	known := sets.NewString()
+	for _, f := range generated {
+		known.Insert(filepath.Clean(f))
+	}
+	var stale []string
+	for _, f := range existing {
+		if !known.Has(filepath.Clean(f)) {
+			stale = append(stale, f)
+		}
+	}
+	return stale, nil
+}
+
+// PruneStaleFiles removes the files returned by FindStaleFiles, as well as the directories left
+// empty by the removal. If dryRun is set, nothing is removed. The stale files are returned.
+func (cli *Client) PruneStaleFiles(dir string, generated []string, dryRun bool) ([]string, error) {
+	stale, err := cli.FindStaleFiles(dir, generated)
+	if err != nil || dryRun {
+		return stale, err
+	}
+	for _, f := range stale {
+		if err := os.Remove(f); err != nil {
+			return nil, fmt.Errorf("failed to remove stale file %s: %v", f, err)
+		}
+		parent := filepath.Dir(f)
+		if files, err := ioutil.ReadDir(parent); err == nil && len(files) == 0 {
+			if err := os.Remove(parent); err != nil {
+				return nil, fmt.Errorf("failed to remove empty directory %s: %v", parent, err)
+			}
+		}
+	}
+	return stale, nil
+}
+
+func (cli *Client) WriteConfig(jobs config.JobConfig, fname string) error {
 	bs, err := yaml.Marshal(jobs)
 	if err != nil {
-		exit(err, "failed to marshal result")
+		return fmt.Errorf("failed to marshal result: %v", err)
 	}
 	dir := filepath.Dir(fname)
 	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
-		exit(err, "failed to create directory: "+dir)
+		return fmt.Errorf("failed to create directory %s: %v", dir, err)
 	}
 	output := []byte(cli.GlobalConfig.AutogenHeader)
 	output = append(output, bs...)
-	err = ioutil.WriteFile(fname, output, 0644)
-	if err != nil {
-		exit(err, "failed to write result")
+	if err := ioutil.WriteFile(fname, output, 0644); err != nil {
+		return fmt.Errorf("failed to write result to %s: %v", fname, err)
 	}
+	return nil
 }
 
-func (cli *Client) PrintConfig(c interface{}) {
+func (cli *Client) PrintConfig(c interface{}) error {
 	bs, err := yaml.Marshal(c)
 	if err != nil {
-		exit(err, "failed to write result")
+		return fmt.Errorf("failed to marshal result: %v", err)
 	}
 	fmt.Println(string(bs))
+	return nil
 }
 
 func validate(input string, options []string, description string) error {
@@ -572,13 +947,6 @@ func validate(input string, options []string, description string) error {
 	return nil
 }
 
-func (cli *Client) DiffConfig(result config.JobConfig, existing config.JobConfig) {
-	fmt.Println("Presubmit diff:")
-	diffConfigPresubmit(result, existing)
-	fmt.Println("\n\nPostsubmit diff:")
-	diffConfigPostsubmit(result, existing)
-}
-
 // FilterReleaseBranchingJobs filters then returns jobs with release branching enabled.
 func FilterReleaseBranchingJobs(jobs []Job) []Job {
 	jobsF := make([]Job, 0)
@@ -591,112 +959,65 @@ func FilterReleaseBranchingJobs(jobs []Job) []Job {
 	return jobsF
 }
 
-func getPresubmit(c config.JobConfig, jobName string) *config.Presubmit {
-	presubmits := c.PresubmitsStatic
-	for _, jobs := range presubmits {
-		for _, job := range jobs {
-			if job.Name == jobName {
-				return &job
-			}
-		}
-	}
-	return nil
-}
-
-func diffConfigPresubmit(result config.JobConfig, pj config.JobConfig) {
-	known := make(map[string]struct{})
-	for _, jobs := range result.PresubmitsStatic {
-		for _, job := range jobs {
-			known[job.Name] = struct{}{}
-			current := getPresubmit(pj, job.Name)
-			if current == nil {
-				fmt.Println("\nCreated unknown presubmit job", job.Name)
-				continue
-			}
-			diff := pretty.Diff(current, &job)
-			if len(diff) > 0 {
-				fmt.Println("\nDiff for", job.Name)
-			}
-			for _, d := range diff {
-				fmt.Println(d)
-			}
-		}
-	}
-	for _, jobs := range pj.PresubmitsStatic {
-		for _, job := range jobs {
-			if _, f := known[job.Name]; !f {
-				fmt.Println("Missing", job.Name)
-			}
+// presetEnvs returns the env of the requirement presets of the job targeting the container, in
+// the order of the requirements.
+func presetEnvs(jobConfig JobsConfig, job Job, container string) [][]v1.EnvVar {
+	var envs [][]v1.EnvVar
+	for _, req := range job.Requirements {
+		if preset := jobConfig.RequirementPresets[req]; preset.targets(container) {
+			envs = append(envs, preset.Env)
 		}
 	}
+	return envs
 }
 
-func diffConfigPostsubmit(result config.JobConfig, pj config.JobConfig) {
-	known := make(map[string]struct{})
-	var allCurrentPostsubmits []config.Postsubmit
-	for _, jobs := range pj.PostsubmitsStatic {
-		allCurrentPostsubmits = append(allCurrentPostsubmits, jobs...)
-	}
-	for _, jobs := range result.PostsubmitsStatic {
-		for _, job := range jobs {
-			known[job.Name] = struct{}{}
-			var current *config.Postsubmit
-			for _, ps := range allCurrentPostsubmits {
-				ps := ps
-				if ps.Name == job.Name {
-					current = &ps
-					break
-				}
-			}
-			if current == nil {
-				fmt.Println("\nCreated unknown job:", job.Name)
-				continue
-
-			}
-			diff := pretty.Diff(current, &job)
-			if len(diff) > 0 {
-				fmt.Println("\nDiff for", job.Name)
-			}
-			for _, d := range diff {
-				fmt.Println(d)
-			}
-		}
-	}
-
-	for _, job := range allCurrentPostsubmits {
-		if _, f := known[job.Name]; !f {
-			fmt.Println("Missing", job.Name)
-		}
-	}
-}
-
-func createContainer(jobConfig JobsConfig, job Job, resources map[string]v1.ResourceRequirements) []v1.Container {
-	envs := job.Env
-	if len(envs) == 0 {
-		envs = jobConfig.Env
-	} else {
-		// TODO: overwrite the env with the same name
-		envs = append(envs, jobConfig.Env...)
-	}
+func createContainer(globalConfig GlobalConfig, jobConfig JobsConfig, job Job, resources map[string]v1.ResourceRequirements) []v1.Container {
+	// The env with the same name is overwritten in the order global -> repo -> requirement
+	// presets -> job.
+	envs := [][]v1.EnvVar{globalConfig.Env, jobConfig.Env}
+	envs = append(envs, presetEnvs(jobConfig, job, TestContainerName)...)
+	envs = append(envs, job.Env)
 
+	// The containers are not privileged unless the job has a requirement granting it.
 	c := v1.Container{
 		Image:           job.Image,
-		SecurityContext: &v1.SecurityContext{Privileged: newTrue()},
+		SecurityContext: job.SecurityContext.DeepCopy(),
 		Command:         job.Command,
-		Env:             envs,
+		Env:             mergeEnvs(envs...),
 	}
 	if job.ImagePullPolicy != "" {
 		c.ImagePullPolicy = v1.PullPolicy(job.ImagePullPolicy)
 	}
-	jobResource := DefaultResource
-	if job.Resource != "" {
-		jobResource = job.Resource
-	}
+	jobResource := resourcePreset(job, jobConfig.RequirementPresets)
 	if _, ok := resources[jobResource]; ok {
 		c.Resources = resources[jobResource]
 	}
 
-	return []v1.Container{c}
+	containers := []v1.Container{c}
+	if len(job.Sidecars) > 0 {
+		// All the containers must be named if there are more than one.
+		containers[0].Name = TestContainerName
+	}
+	for _, sidecar := range job.Sidecars {
+		containers = append(containers, createExtraContainer(jobConfig, job, sidecar))
+	}
+	return containers
+}
+
+func createInitContainers(jobConfig JobsConfig, job Job) []v1.Container {
+	var containers []v1.Container
+	for _, c := range job.InitContainers {
+		containers = append(containers, createExtraContainer(jobConfig, job, c))
+	}
+	return containers
+}
+
+// createExtraContainer copies a sidecar or init container of the job. As for the test container,
+// the env with the same name is overwritten in the order requirement presets -> job.
+func createExtraContainer(jobConfig JobsConfig, job Job, container v1.Container) v1.Container {
+	c := *container.DeepCopy()
+	c.Env = mergeEnvs(append(presetEnvs(jobConfig, job, c.Name), c.Env)...)
+	return c
 }
 
 func createJobBase(globalConfig GlobalConfig, jobConfig JobsConfig, job Job,
@@ -706,12 +1027,19 @@ func createJobBase(globalConfig GlobalConfig, jobConfig JobsConfig, job Job,
 		Name:           name,
 		MaxConcurrency: job.MaxConcurrency,
 		Spec: &v1.PodSpec{
-			Containers:   createContainer(jobConfig, job, resources),
-			NodeSelector: job.NodeSelector,
+			// The slices are copied since the requirement presets append to them.
+			Containers:                createContainer(globalConfig, jobConfig, job, resources),
+			InitContainers:            createInitContainers(jobConfig, job),
+			NodeSelector:              job.NodeSelector,
+			SecurityContext:           job.PodSecurityContext.DeepCopy(),
+			Tolerations:               append([]v1.Toleration(nil), job.Tolerations...),
+			Affinity:                  job.Affinity.DeepCopy(),
+			TopologySpreadConstraints: append([]v1.TopologySpreadConstraint(nil), job.TopologySpreadConstraints...),
+			PriorityClassName:         job.PriorityClassName,
 		},
 		UtilityConfig: config.UtilityConfig{
 			Decorate:  &yes,
-			ExtraRefs: createExtraRefs(job.Repos, branch, globalConfig.PathAliases),
+			ExtraRefs: createExtraRefs(requiredRepos(job, jobConfig.RequirementPresets), branch, globalConfig.PathAliases),
 		},
 		ReporterConfig: job.ReporterConfig,
 		Labels:         job.Labels,
@@ -817,63 +1145,6 @@ func applyModifiersPostsubmit(postsubmit *config.Postsubmit, jobModifiers []stri
 	}
 }
 
-func applyMatrixJob(job Job, matrix map[string][]string) []Job {
-	yamlStr, err := yaml.Marshal(job)
-	if err != nil {
-		exit(err, "failed to marshal the given Job")
-	}
-	expandedYamlStr := applyMatrix(string(yamlStr), matrix)
-	jobs := make([]Job, 0)
-	for _, jobYaml := range expandedYamlStr {
-		job := &Job{}
-		if err := yaml.Unmarshal([]byte(jobYaml), job); err != nil {
-			exit(err, "failed to unmarshal the yaml to Job")
-		}
-		jobs = append(jobs, *job)
-	}
-	return jobs
-}
-
-func applyMatrix(yamlStr string, matrix map[string][]string) []string {
-	subsExps := getVarSubstitutionExpressions(yamlStr)
-	if len(subsExps) == 0 {
-		return []string{yamlStr}
-	}
-
-	combs := make([]string, 0)
-	for _, exp := range subsExps {
-		if strings.HasPrefix(exp, "matrix.") {
-			exp = strings.TrimPrefix(exp, "matrix.")
-			if _, ok := matrix[exp]; ok {
-				combs = append(combs, exp)
-			} else {
-				exit(errors.New("dimension is not configured in the matrix"), exp)
-			}
-		}
-	}
-
-	res := &[]string{}
-	resolveCombinations(combs, yamlStr, 0, matrix, res)
-	return *res
-}
-
-func resolveCombinations(combs []string, dest string, start int, matrix map[string][]string, res *[]string) {
-	if start == len(combs) {
-		*res = append(*res, dest)
-		return
-	}
-
-	lst := matrix[combs[start]]
-	for i := range lst {
-		dest := replace(dest, combs[start], lst[i])
-		resolveCombinations(combs, dest, start+1, matrix, res)
-	}
-}
-
-func replace(str, expKey, expVal string) string {
-	return strings.ReplaceAll(str, "$(matrix."+expKey+")", expVal)
-}
-
 // getVarSubstitutionExpressions extracts all the value between "$(" and ")""
 func getVarSubstitutionExpressions(yamlStr string) []string {
 	allExpressions := validateString(yamlStr)
@@ -902,16 +1173,16 @@ func stripVarSubExpression(expression string) string {
 }
 
 // Reads the generate job config for comparison
-func ReadProwJobConfig(file string) config.JobConfig {
+func ReadProwJobConfig(file string) (config.JobConfig, error) {
 	yamlFile, err := ioutil.ReadFile(file)
 	if err != nil {
-		exit(err, "failed to read "+file)
+		return config.JobConfig{}, fmt.Errorf("failed to read %s: %v", file, err)
 	}
 	jobs := config.JobConfig{}
 	if err := yaml.Unmarshal(yamlFile, &jobs); err != nil {
-		exit(err, "failed to unmarshal "+file)
+		return config.JobConfig{}, fmt.Errorf("failed to unmarshal %s: %v", file, err)
 	}
-	return jobs
+	return jobs, nil
 }
 
 // kubernetes API requires a pointer to a bool for some reason
@@ -920,6 +1191,21 @@ func newTrue() *bool {
 	return &b
 }
 
+// sourceAnnotations returns the annotations pointing at the meta config job a job is generated from.
+func sourceAnnotations(file, job string, matrix map[string]string) map[string]string {
+	if file == "" {
+		return nil
+	}
+	res := map[string]string{
+		SourceFileAnnotation: file,
+		SourceJobAnnotation:  job,
+	}
+	if len(matrix) > 0 {
+		res[SourceMatrixAnnotation] = formatMatrixValues(matrix)
+	}
+	return res
+}
+
 // mergeMaps will merge multiple maps into one.
 // If there are duplicated keys in the maps, the value in the later maps will overwrite that of the previous ones.
 func mergeMaps(mps ...map[string]string) map[string]string {
@@ -932,6 +1218,24 @@ func mergeMaps(mps ...map[string]string) map[string]string {
 	return newMap
 }
 
+// mergeEnvs merges the env lists by name. An env is overwritten by the env with the same name in
+// a later list, keeping the position it first appeared at.
+func mergeEnvs(envs ...[]v1.EnvVar) []v1.EnvVar {
+	var res []v1.EnvVar
+	index := map[string]int{}
+	for _, env := range envs {
+		for _, e := range env {
+			if i, ok := index[e.Name]; ok {
+				res[i] = e
+				continue
+			}
+			index[e.Name] = len(res)
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
 func mergeSlices(slices ...[]string) []string {
 	set := sets.NewString()
 	// Use res to store the merged results to keep the sequence.
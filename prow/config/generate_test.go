@@ -16,22 +16,39 @@ package config
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+
+	"github.com/hashicorp/go-multierror"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 func TestGenerateConfig(t *testing.T) {
-	settings := ReadGlobalSettings("testdata/.global.yaml")
+	settings, err := ReadGlobalSettings("testdata/.global.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
 	cli := &Client{GlobalConfig: settings}
-	tests := []string{"simple", "simple-matrix"}
+	tests := []string{"simple", "simple-matrix", "templates", "sidecars", "gerrit"}
 	for _, tt := range tests {
 		t.Run(tt, func(t *testing.T) {
-			jobs := cli.ReadJobsConfig(fmt.Sprintf("testdata/%s.yaml", tt))
+			jobs, err := cli.ReadJobsConfig(fmt.Sprintf("testdata/%s.yaml", tt))
+			if err != nil {
+				t.Fatal(err)
+			}
 			for _, branch := range jobs.Branches {
-				output := cli.ConvertJobConfig(jobs, branch)
+				output, err := cli.ConvertJobConfig(jobs, branch)
+				if err != nil {
+					t.Fatal(err)
+				}
 				if os.Getenv("REFRESH_GOLDEN") == "true" {
-					cli.WriteConfig(output, fmt.Sprintf("testdata/%s.gen.yaml", tt))
+					if err := cli.WriteConfig(output, fmt.Sprintf("testdata/%s.gen.yaml", tt)); err != nil {
+						t.Fatal(err)
+					}
 				}
 				if err := cli.CheckConfig(output, fmt.Sprintf("testdata/%s.gen.yaml", tt)); err != nil {
 					t.Fatal(err.Error())
@@ -41,6 +58,371 @@ func TestGenerateConfig(t *testing.T) {
 	}
 }
 
+func TestFindGeneratedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "generated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cli := &Client{GlobalConfig: GlobalConfig{AutogenHeader: DefaultAutogenHeader + "\n"}}
+	files := map[string]string{
+		"istio/istio/istio.istio.master.gen.yaml":      DefaultAutogenHeader + "\npresubmits: {}\n",
+		"istio/istio/istio.istio.release-1.0.gen.yaml": DefaultAutogenHeader + "\npresubmits: {}\n",
+		"istio/istio/istio.istio.private.gen.yaml":     "# generated by another tool\npresubmits: {}\n",
+		"istio/istio/istio.istio.master.yaml":          DefaultAutogenHeader + "\npresubmits: {}\n",
+	}
+	writeTestFiles(t, dir, files)
+
+	actual, err := cli.FindGeneratedFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		filepath.Join(dir, "istio/istio/istio.istio.master.gen.yaml"),
+		filepath.Join(dir, "istio/istio/istio.istio.release-1.0.gen.yaml"),
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("generated files do not match; actual: %v\n expected %v\n", actual, expected)
+	}
+}
+
+func TestPruneStaleFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "generated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cli := &Client{GlobalConfig: GlobalConfig{AutogenHeader: DefaultAutogenHeader + "\n"}}
+	writeTestFiles(t, dir, map[string]string{
+		"istio/istio/istio.istio.master.gen.yaml":      DefaultAutogenHeader + "\npresubmits: {}\n",
+		"istio/istio/istio.istio.release-1.0.gen.yaml": DefaultAutogenHeader + "\npresubmits: {}\n",
+		"istio/old/istio.old.master.gen.yaml":          DefaultAutogenHeader + "\npresubmits: {}\n",
+	})
+	generated := []string{filepath.Join(dir, "istio/istio/istio.istio.master.gen.yaml")}
+	expected := []string{
+		filepath.Join(dir, "istio/istio/istio.istio.release-1.0.gen.yaml"),
+		filepath.Join(dir, "istio/old/istio.old.master.gen.yaml"),
+	}
+
+	stale, err := cli.PruneStaleFiles(dir, generated, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, stale) {
+		t.Errorf("stale files do not match; actual: %v\n expected %v\n", stale, expected)
+	}
+	for _, f := range expected {
+		if _, err := os.Stat(f); err != nil {
+			t.Errorf("dry run removed %s", f)
+		}
+	}
+
+	stale, err = cli.PruneStaleFiles(dir, generated, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, stale) {
+		t.Errorf("stale files do not match; actual: %v\n expected %v\n", stale, expected)
+	}
+	for _, f := range append(expected, filepath.Join(dir, "istio/old")) {
+		if _, err := os.Stat(f); !os.IsNotExist(err) {
+			t.Errorf("%s was not removed", f)
+		}
+	}
+	if _, err := os.Stat(generated[0]); err != nil {
+		t.Errorf("generated file was removed: %v", err)
+	}
+}
+
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		fname := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(fname), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fname, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestValidateJobConfig(t *testing.T) {
+	cli := &Client{}
+	testCases := []struct {
+		name     string
+		config   JobsConfig
+		expected []ValidationError
+	}{
+		{
+			name: "valid config",
+			config: JobsConfig{
+				Org:  "istio",
+				Repo: "istio",
+				Jobs: []Job{{Name: "unit", Image: "foo", Command: []string{"make", "test"}}},
+			},
+		},
+		{
+			name: "missing org and image",
+			config: JobsConfig{
+				Repo: "istio",
+				Jobs: []Job{{Name: "unit", Command: []string{"make", "test"}}},
+			},
+			expected: []ValidationError{
+				{File: "test.yaml", Field: "org", Message: "org must be set"},
+				{File: "test.yaml", Job: "unit", Field: "image", Message: "image must be set"},
+			},
+		},
+		{
+			name: "invalid modifier and periodic without schedule",
+			config: JobsConfig{
+				Org:  "istio",
+				Repo: "istio",
+				Jobs: []Job{{Name: "nightly", Image: "foo", Types: []string{TypePeriodic}, Modifiers: []string{"flaky"}}},
+			},
+			expected: []ValidationError{
+				{File: "test.yaml", Job: "nightly", Field: "modifiers", Message: "'flaky' is not a valid status. Must be one of hidden, optional, skipped"},
+				{File: "test.yaml", Job: "nightly", Field: "cron", Message: "cron and interval cannot be both empty in periodic"},
+			},
+		},
+		{
+			name: "unknown matrix dimension",
+			config: JobsConfig{
+				Org:    "istio",
+				Repo:   "istio",
+				Matrix: &Matrix{Dimensions: map[string][]string{"foo": {"a"}}},
+				Jobs:   []Job{{Name: "test-$(matrix.bar)", Image: "foo"}},
+			},
+			expected: []ValidationError{
+				{File: "test.yaml", Job: "test-$(matrix.bar)", Field: "matrix", Message: `dimension "bar" is not configured in the matrix`},
+			},
+		},
+		{
+			name: "invalid sidecars",
+			config: JobsConfig{
+				Org:  "istio",
+				Repo: "istio",
+				Jobs: []Job{{
+					Name: "unit", Image: "foo",
+					Sidecars:       []v1.Container{{Name: "test", Image: "bar"}, {Image: "bar"}},
+					InitContainers: []v1.Container{{Name: "setup"}},
+				}},
+			},
+			expected: []ValidationError{
+				{File: "test.yaml", Job: "unit", Field: "containers", Message: "container name test is not unique"},
+				{File: "test.yaml", Job: "unit", Field: "containers", Message: "sidecars and init containers must be named"},
+				{File: "test.yaml", Job: "unit", Field: "containers", Message: "image of container setup must be set"},
+			},
+		},
+		{
+			name: "privileged without a requirement granting it",
+			config: JobsConfig{
+				Org:                "istio",
+				Repo:               "istio",
+				RequirementPresets: map[string]RequirementPreset{"docker": {Privileged: true}, "gcp": {}},
+				Jobs: []Job{
+					{Name: "unit", Image: "foo", Requirements: []string{"gcp"}, SecurityContext: &v1.SecurityContext{Privileged: newTrue()}},
+					{Name: "build", Image: "foo", Requirements: []string{"docker"}, SecurityContext: &v1.SecurityContext{Privileged: newTrue()}},
+				},
+			},
+			expected: []ValidationError{
+				{File: "test.yaml", Job: "unit", Field: "security_context", Message: "container test is privileged without a requirement granting the privileged mode"},
+			},
+		},
+		{
+			name: "required presets",
+			config: JobsConfig{
+				Org:  "istio",
+				Repo: "istio",
+				RequirementPresets: map[string]RequirementPreset{
+					"docker": {Privileged: true, Env: []v1.EnvVar{{Name: "A", Value: "a"}}},
+					"kind":   {Requires: []string{"docker"}, Env: []v1.EnvVar{{Name: "A", Value: "b"}}},
+				},
+				Jobs: []Job{{Name: "kind", Image: "foo", Requirements: []string{"kind"}, SecurityContext: &v1.SecurityContext{Privileged: newTrue()}}},
+			},
+			expected: []ValidationError{
+				{File: "test.yaml", Job: "kind", Field: "requirements", Message: "requirements docker and kind define the env A differently"},
+			},
+		},
+		{
+			name: "env set twice",
+			config: JobsConfig{
+				Org:  "istio",
+				Repo: "istio",
+				Jobs: []Job{{Name: "unit", Image: "foo", Env: []v1.EnvVar{{Name: "A", Value: "a"}, {Name: "A", Value: "b"}}}},
+			},
+			expected: []ValidationError{
+				{File: "test.yaml", Job: "unit", Field: "env", Message: "env A is set more than once"},
+			},
+		},
+		{
+			name: "change matchers",
+			config: JobsConfig{
+				Org:  "istio",
+				Repo: "istio",
+				Jobs: []Job{
+					{Name: "unit", Image: "foo", Regex: "foo.*", RunIfChangedPaths: []string{"foo/"}},
+					{Name: "lint", Image: "foo", SkipIfOnlyChangedPaths: []string{"/docs/"}},
+				},
+			},
+			expected: []ValidationError{
+				{File: "test.yaml", Job: "unit", Field: "regex", Message: "regex, run_if_changed_paths and skip_if_only_changed_paths are mutually exclusive"},
+				{File: "test.yaml", Job: "lint", Field: "skip_if_only_changed_paths", Message: `invalid path "/docs/", must be a path relative to the root of the repo`},
+			},
+		},
+		{
+			name: "invalid testgrid settings",
+			config: JobsConfig{
+				Org:      "istio",
+				Repo:     "istio",
+				Testgrid: &JobTestgridConfig{TabName: "unit", NumFailuresToAlert: "0"},
+				Jobs:     []Job{{Name: "unit", Image: "foo", Testgrid: &JobTestgridConfig{AlertStaleResultsHours: "a day"}}},
+			},
+			expected: []ValidationError{
+				{File: "test.yaml", Field: "testgrid", Message: "tab_name can only be set for a job"},
+				{File: "test.yaml", Field: "testgrid", Message: `num_failures_to_alert "0" must be a positive number`},
+				{File: "test.yaml", Job: "unit", Field: "testgrid", Message: `alert_stale_results_hours "a day" must be a positive number`},
+			},
+		},
+		{
+			name: "invalid trigger modes",
+			config: JobsConfig{
+				Org:  "istio",
+				Repo: "istio",
+				Jobs: []Job{
+					{Name: "manual", Image: "foo", TriggerMode: TriggerModeManual, RunIfChangedPaths: []string{"pkg/"}, Modifiers: []string{ModifierSkipped}},
+					{Name: "post", Image: "foo", TriggerMode: TriggerModeManual, Types: []string{TypePostsubmit}},
+					{Name: "label", Image: "foo", TriggerMode: "label"},
+				},
+			},
+			expected: []ValidationError{
+				{File: "test.yaml", Job: "manual", Field: "trigger_mode", Message: "trigger_mode manual cannot be combined with the skipped modifier"},
+				{File: "test.yaml", Job: "manual", Field: "trigger_mode", Message: "trigger_mode manual cannot be combined with regex, run_if_changed_paths or skip_if_only_changed_paths"},
+				{File: "test.yaml", Job: "post", Field: "trigger_mode", Message: "trigger_mode manual only applies to presubmits"},
+				{File: "test.yaml", Job: "label", Field: "trigger_mode", Message: "trigger_mode label is not supported as Prow cannot trigger presubmits on labels, use trigger_mode manual instead"},
+			},
+		},
+		{
+			name: "gerrit without host",
+			config: JobsConfig{
+				Org:    "istio",
+				Repo:   "proxy",
+				Gerrit: &GerritConfig{PresubmitLabel: "Verified"},
+				Jobs:   []Job{{Name: "unit", Image: "foo"}},
+			},
+			expected: []ValidationError{
+				{File: "test.yaml", Field: "gerrit", Message: "host must be set"},
+			},
+		},
+		{
+			name: "invalid gerrit host and project",
+			config: JobsConfig{
+				Org:    "istio",
+				Repo:   "proxy",
+				Gerrit: &GerritConfig{Host: "https://istio-review.googlesource.com/istio", Project: "/proxy"},
+				Jobs:   []Job{{Name: "unit", Image: "foo"}},
+			},
+			expected: []ValidationError{
+				{File: "test.yaml", Field: "gerrit", Message: "host https://istio-review.googlesource.com/istio must be a host name, without a path or a scheme other than https"},
+				{File: "test.yaml", Field: "gerrit", Message: "project /proxy must not start or end with /"},
+			},
+		},
+		{
+			name: "duplicated job names after the matrix expansion",
+			config: JobsConfig{
+				Org:    "istio",
+				Repo:   "istio",
+				Matrix: &Matrix{Dimensions: map[string][]string{"foo": {"a", "b"}}},
+				Jobs: []Job{
+					{Name: "test-$(matrix.foo)", Image: "foo", Types: []string{TypePresubmit}},
+					{Name: "test-b", Image: "foo"},
+				},
+			},
+			expected: []ValidationError{
+				{File: "test.yaml", Job: "test-b", Field: "name", Message: "duplicated presubmit job name"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := cli.ValidateJobConfig("test.yaml", tc.config)
+			if len(tc.expected) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			merr, ok := err.(*multierror.Error)
+			if !ok {
+				t.Fatalf("expected a multierror, got %v", err)
+			}
+			var actual []ValidationError
+			for _, e := range merr.Errors {
+				ve, ok := e.(*ValidationError)
+				if !ok {
+					t.Fatalf("expected a ValidationError, got %v", e)
+				}
+				actual = append(actual, *ve)
+			}
+			if !reflect.DeepEqual(tc.expected, actual) {
+				t.Errorf("validation errors do not match; actual: %v\n expected %v\n", actual, tc.expected)
+			}
+		})
+	}
+}
+
+func TestGenerateJobConfigs(t *testing.T) {
+	cli := &Client{GlobalConfig: GlobalConfig{
+		ResourcePresets: map[string]v1.ResourceRequirements{
+			DefaultResource: {Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")}},
+		},
+	}}
+	metaConfigs := []MetaConfig{
+		{
+			Path: "istio.yaml",
+			JobsConfig: JobsConfig{
+				Org: "istio", Repo: "istio", Branches: []string{"master"}, Image: "foo",
+				Jobs: []Job{{Name: "unit", Types: []string{TypePresubmit}}},
+				ResourcePresets: map[string]v1.ResourceRequirements{
+					DefaultResource: {Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("8")}},
+				},
+			},
+		},
+		{
+			Path: "istio-extra.yaml",
+			JobsConfig: JobsConfig{
+				Org: "istio", Repo: "istio", Branches: []string{"master"}, Image: "foo",
+				Jobs: []Job{{Name: "lint", Types: []string{TypePresubmit}}},
+			},
+		},
+	}
+	for i, mc := range metaConfigs {
+		metaConfigs[i].JobsConfig = resolveOverwrites(cli.GlobalConfig, mc.JobsConfig)
+	}
+
+	output, err := cli.GenerateJobConfigs(metaConfigs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := Ref{Org: "istio", Repo: "istio", Branch: "master"}
+	if refs := SortedRefs(output); !reflect.DeepEqual(refs, []Ref{ref}) {
+		t.Fatalf("expected the meta configs to be combined into %v, got %v", ref, refs)
+	}
+	presubmits := output[ref].PresubmitsStatic["istio/istio"]
+	cpus := map[string]string{}
+	for _, p := range presubmits {
+		cpus[p.Name] = p.Spec.Containers[0].Resources.Requests.Cpu().String()
+	}
+	// The resource presets of a meta config file must not leak into the others.
+	expected := map[string]string{"unit_istio": "8", "lint_istio": "1"}
+	if !reflect.DeepEqual(expected, cpus) {
+		t.Errorf("cpu requests do not match; actual: %v\n expected %v\n", cpus, expected)
+	}
+}
+
 func TestFilterReleaseBranchingJobs(t *testing.T) {
 	testCases := []struct {
 		name         string
@@ -158,3 +540,155 @@ func TestMergeMaps(t *testing.T) {
 		}
 	}
 }
+
+func TestCreateContainerEnv(t *testing.T) {
+	secretEnv := v1.EnvVar{Name: "TOKEN", ValueFrom: &v1.EnvVarSource{
+		SecretKeyRef: &v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: "token"}, Key: "token"},
+	}}
+	globalConfig := GlobalConfig{Env: []v1.EnvVar{{Name: "A", Value: "global"}, {Name: "B", Value: "global"}, {Name: "TOKEN", Value: "global"}}}
+	jobsConfig := JobsConfig{
+		Env: []v1.EnvVar{{Name: "B", Value: "repo"}, {Name: "C", Value: "repo"}, {Name: "D", Value: "repo"}},
+		RequirementPresets: map[string]RequirementPreset{
+			"gcp": {Env: []v1.EnvVar{{Name: "C", Value: "preset"}, secretEnv}},
+		},
+	}
+	job := Job{Requirements: []string{"gcp"}, Env: []v1.EnvVar{{Name: "D", Value: "job"}, {Name: "E", Value: "job"}}}
+
+	containers := createContainer(globalConfig, jobsConfig, job, nil)
+	expected := []v1.EnvVar{
+		{Name: "A", Value: "global"},
+		{Name: "B", Value: "repo"},
+		secretEnv,
+		{Name: "C", Value: "preset"},
+		{Name: "D", Value: "job"},
+		{Name: "E", Value: "job"},
+	}
+	if !reflect.DeepEqual(expected, containers[0].Env) {
+		t.Errorf("env does not match; actual: %v\n expected %v\n", containers[0].Env, expected)
+	}
+}
+
+func TestExtraContainerEnv(t *testing.T) {
+	jobsConfig := JobsConfig{
+		RequirementPresets: map[string]RequirementPreset{
+			"docker": {Containers: []string{"dind", "setup"}, Env: []v1.EnvVar{{Name: "A", Value: "docker"}, {Name: "B", Value: "docker"}}},
+			"dind":   {Containers: []string{"dind"}, Env: []v1.EnvVar{{Name: "A", Value: "dind"}, {Name: "C", Value: "dind"}}},
+		},
+	}
+	job := Job{
+		Requirements:   []string{"docker", "dind"},
+		Sidecars:       []v1.Container{{Name: "dind", Env: []v1.EnvVar{{Name: "C", Value: "job"}, {Name: "D", Value: "job"}}}},
+		InitContainers: []v1.Container{{Name: "setup"}},
+	}
+
+	// The later preset overwrites the earlier one, and the job overwrites the presets.
+	containers := createContainer(GlobalConfig{}, jobsConfig, job, nil)
+	expected := []v1.EnvVar{
+		{Name: "A", Value: "dind"},
+		{Name: "B", Value: "docker"},
+		{Name: "C", Value: "job"},
+		{Name: "D", Value: "job"},
+	}
+	if len(containers) != 2 || len(containers[0].Env) != 0 {
+		t.Fatalf("the presets must only set the env of the dind sidecar, got %v", containers)
+	}
+	if !reflect.DeepEqual(expected, containers[1].Env) {
+		t.Errorf("sidecar env does not match; actual: %v\n expected %v\n", containers[1].Env, expected)
+	}
+	initContainers := createInitContainers(jobsConfig, job)
+	expected = []v1.EnvVar{{Name: "A", Value: "docker"}, {Name: "B", Value: "docker"}}
+	if !reflect.DeepEqual(expected, initContainers[0].Env) {
+		t.Errorf("init container env does not match; actual: %v\n expected %v\n", initContainers[0].Env, expected)
+	}
+	if job.Sidecars[0].Env[0].Value != "job" || len(job.Sidecars[0].Env) != 2 || job.InitContainers[0].Env != nil {
+		t.Errorf("the containers of the job must not be modified: %v %v", job.Sidecars, job.InitContainers)
+	}
+}
+
+func TestSchedulingSettings(t *testing.T) {
+	dedicated := v1.Toleration{Key: "dedicated", Operator: v1.TolerationOpEqual, Value: "benchmark", Effect: v1.TaintEffectNoSchedule}
+	gpu := v1.Toleration{Key: "gpu", Operator: v1.TolerationOpExists}
+	globalConfig := GlobalConfig{
+		Tolerations:       []v1.Toleration{gpu},
+		PriorityClassName: "low",
+		RequirementPresets: map[string]RequirementPreset{
+			"benchmark": {Tolerations: []v1.Toleration{dedicated}, PriorityClassName: "high"},
+		},
+	}
+	jobsConfig := resolveOverwrites(globalConfig, JobsConfig{
+		Org: "istio", Repo: "istio", Image: "foo",
+		Jobs: []Job{
+			{Name: "unit", Types: []string{TypePresubmit}},
+			{Name: "benchmark", Types: []string{TypePresubmit}, Requirements: []string{"benchmark"}, PriorityClassName: "medium", Tolerations: []v1.Toleration{}},
+		},
+	})
+	cli := &Client{GlobalConfig: globalConfig}
+	output, err := cli.ConvertJobConfig(jobsConfig, "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	presubmits := output.PresubmitsStatic["istio/istio"]
+	if len(presubmits) != 2 {
+		t.Fatalf("expected 2 presubmits, got %d", len(presubmits))
+	}
+
+	unit := presubmits[0].Spec
+	if !reflect.DeepEqual([]v1.Toleration{gpu}, unit.Tolerations) || unit.PriorityClassName != "low" {
+		t.Errorf("global scheduling settings are not applied: %v %v", unit.Tolerations, unit.PriorityClassName)
+	}
+	benchmark := presubmits[1].Spec
+	if !reflect.DeepEqual([]v1.Toleration{dedicated}, benchmark.Tolerations) || benchmark.PriorityClassName != "medium" {
+		t.Errorf("job and preset scheduling settings are not applied: %v %v", benchmark.Tolerations, benchmark.PriorityClassName)
+	}
+}
+
+func TestRequirementPresetPodSettings(t *testing.T) {
+	globalConfig := GlobalConfig{
+		NodeSelector: map[string]string{"testing": "test-pool"},
+		ResourcePresets: map[string]v1.ResourceRequirements{
+			DefaultResource: {Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")}},
+			"large":         {Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("8")}},
+		},
+		RequirementPresets: map[string]RequirementPreset{
+			"gcp": {
+				ServiceAccountName: "prowjob-default-sa",
+				NodeSelector:       map[string]string{"testing": "gcp-pool", "iam.gke.io/gke-metadata-server-enabled": "true"},
+				Resource:           "large",
+				Repos:              []string{"istio/tools@master", "istio/api"},
+			},
+		},
+	}
+	jobsConfig := resolveOverwrites(globalConfig, JobsConfig{
+		Org: "istio", Repo: "istio", Image: "foo",
+		Jobs: []Job{
+			{Name: "unit", Types: []string{TypePresubmit}},
+			{Name: "e2e", Types: []string{TypePresubmit}, Requirements: []string{"gcp"}, Repos: []string{"istio/tools"}},
+		},
+	})
+	cli := &Client{GlobalConfig: globalConfig}
+	output, err := cli.ConvertJobConfig(jobsConfig, "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	presubmits := output.PresubmitsStatic["istio/istio"]
+
+	unit := presubmits[0]
+	if unit.Spec.ServiceAccountName != "" || !reflect.DeepEqual(globalConfig.NodeSelector, unit.Spec.NodeSelector) ||
+		!reflect.DeepEqual(globalConfig.ResourcePresets[DefaultResource], unit.Spec.Containers[0].Resources) || len(unit.ExtraRefs) != 0 {
+		t.Errorf("unexpected settings for the job without requirement: %+v", unit.JobBase)
+	}
+	e2e := presubmits[1]
+	if e2e.Spec.ServiceAccountName != "prowjob-default-sa" {
+		t.Errorf("service account is not set: %q", e2e.Spec.ServiceAccountName)
+	}
+	expectedNodeSelector := map[string]string{"testing": "test-pool", "iam.gke.io/gke-metadata-server-enabled": "true"}
+	if !reflect.DeepEqual(expectedNodeSelector, e2e.Spec.NodeSelector) {
+		t.Errorf("node selector does not match; actual: %v\n expected %v\n", e2e.Spec.NodeSelector, expectedNodeSelector)
+	}
+	if !reflect.DeepEqual(globalConfig.ResourcePresets["large"], e2e.Spec.Containers[0].Resources) {
+		t.Errorf("resources do not match: %v", e2e.Spec.Containers[0].Resources)
+	}
+	if len(e2e.ExtraRefs) != 2 || e2e.ExtraRefs[0].Repo != "tools" || e2e.ExtraRefs[1].Repo != "api" {
+		t.Errorf("extra refs do not match: %v", e2e.ExtraRefs)
+	}
+}
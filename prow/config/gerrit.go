@@ -0,0 +1,111 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// gerritMagicFiles matches the files Gerrit lists as changed by every change besides the ones of
+// the repo, i.e. the commit message and the parents of the merge commits.
+const gerritMagicFiles = `^/(?:COMMIT_MSG|MERGE_LIST)$`
+
+// GerritConfig makes the jobs of a meta config run for the changes of a Gerrit project instead of
+// the pull requests of a GitHub repo. The org and repo of the meta config still name the jobs, the
+// testgrid dashboards and the generated files.
+type GerritConfig struct {
+	// Host is the Gerrit host the changes are reviewed on, e.g. istio-review.googlesource.com.
+	Host string `json:"host,omitempty"`
+	// Project is the Gerrit project, <org>/<repo> if not set.
+	Project string `json:"project,omitempty"`
+	// PresubmitLabel and PostsubmitLabel are the labels Prow votes with the results of the jobs on,
+	// unless the job sets its own. Prow votes Code-Review if they are not set.
+	PresubmitLabel  string `json:"presubmit_label,omitempty"`
+	PostsubmitLabel string `json:"postsubmit_label,omitempty"`
+}
+
+// host returns the host without the scheme, which Prow always clones with https.
+func (g *GerritConfig) host() string {
+	return strings.TrimSuffix(strings.TrimPrefix(g.Host, "https://"), "/")
+}
+
+func (jc JobsConfig) gerritProject() string {
+	if jc.Gerrit.Project != "" {
+		return jc.Gerrit.Project
+	}
+	return jc.Org + "/" + jc.Repo
+}
+
+// repoKey returns the key of the presubmits and postsubmits of the repo in the Prow config,
+// <org>/<repo> for GitHub and <host>/<project> for Gerrit.
+func (jc JobsConfig) repoKey() string {
+	if jc.Gerrit != nil {
+		return jc.Gerrit.host() + "/" + jc.gerritProject()
+	}
+	return jc.Org + "/" + jc.Repo
+}
+
+// cloneURI returns the URI the repo is cloned from, empty to clone it from GitHub.
+func (jc JobsConfig) cloneURI() string {
+	if jc.CloneURI != "" {
+		return jc.CloneURI
+	}
+	if jc.Gerrit != nil {
+		return "https://" + jc.repoKey()
+	}
+	return ""
+}
+
+// pathAlias returns the path the repo is cloned to under $GOPATH/src. The Gerrit projects are
+// cloned to <host>/<project> unless the org has a path alias, rather than under github.com.
+func (jc JobsConfig) pathAlias(pathAliases map[string]string) string {
+	if pa, ok := pathAliases[jc.Org]; ok {
+		return fmt.Sprintf("%s/%s", pa, jc.Repo)
+	}
+	if jc.Gerrit != nil {
+		return jc.repoKey()
+	}
+	return ""
+}
+
+// reportLabels returns the Gerrit labels the presubmit and postsubmit of the job report on.
+func (jc JobsConfig) reportLabels(job Job) (string, string) {
+	presubmit, postsubmit := job.GerritPresubmitLabel, job.GerritPostsubmitLabel
+	if jc.Gerrit != nil {
+		if presubmit == "" {
+			presubmit = jc.Gerrit.PresubmitLabel
+		}
+		if postsubmit == "" {
+			postsubmit = jc.Gerrit.PostsubmitLabel
+		}
+	}
+	return presubmit, postsubmit
+}
+
+func validateGerrit(fileName string, gerrit *GerritConfig) error {
+	var err *multierror.Error
+	if gerrit.Host == "" {
+		err = multierror.Append(err, newValidationError(fileName, "", "gerrit", "host must be set"))
+	} else if h := gerrit.host(); strings.Contains(h, "://") || strings.Contains(h, "/") {
+		err = multierror.Append(err, newValidationError(fileName, "", "gerrit", "host %s must be a host name, without a path or a scheme other than https", gerrit.Host))
+	}
+	if p := gerrit.Project; p != "" && (strings.HasPrefix(p, "/") || strings.HasSuffix(p, "/")) {
+		err = multierror.Append(err, newValidationError(fileName, "", "gerrit", "project %s must not start or end with /", p))
+	}
+	return err.ErrorOrNil()
+}
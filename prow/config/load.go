@@ -0,0 +1,152 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"k8s.io/test-infra/prow/config"
+)
+
+// GlobalConfigFile is the name of the global config file in the jobs directory.
+const GlobalConfigFile = ".global.yaml"
+
+// MetaConfig is a meta config read from a file in the jobs directory.
+type MetaConfig struct {
+	// Path is the path of the meta config file.
+	Path       string
+	JobsConfig JobsConfig
+}
+
+// Ref identifies the generated job config of an org/repo:branch.
+type Ref struct {
+	Org    string
+	Repo   string
+	Branch string
+}
+
+func (r Ref) String() string {
+	return fmt.Sprintf("%s/%s:%s", r.Org, r.Repo, r.Branch)
+}
+
+// FileName returns the path of the file the job config of the ref is written to under dir.
+func (r Ref) FileName(dir string) string {
+	return filepath.Join(dir, r.Org, r.Repo, fmt.Sprintf("%s.%s.%s.gen.yaml", r.Org, r.Repo, r.Branch))
+}
+
+// refOfFile returns the ref of a file named by FileName, or false if the name does not match.
+func refOfFile(fname string) (Ref, bool) {
+	repo := filepath.Base(filepath.Dir(fname))
+	org := filepath.Base(filepath.Dir(filepath.Dir(fname)))
+	prefix, suffix := fmt.Sprintf("%s.%s.", org, repo), ".gen.yaml"
+	base := filepath.Base(fname)
+	if !strings.HasPrefix(base, prefix) || !strings.HasSuffix(base, suffix) || len(base) <= len(prefix)+len(suffix) {
+		return Ref{}, false
+	}
+	return Ref{Org: org, Repo: repo, Branch: strings.TrimSuffix(strings.TrimPrefix(base, prefix), suffix)}, true
+}
+
+// IsMetaConfigFile returns whether the file is a meta config file, i.e. a yaml file other than
+// the global config.
+func IsMetaConfigFile(name string) bool {
+	ext := filepath.Ext(name)
+	return (ext == ".yaml" || ext == ".yml") && filepath.Base(name) != GlobalConfigFile
+}
+
+// ReadJobsConfigs reads all the meta config files under dir, in lexical order.
+func (cli *Client) ReadJobsConfigs(dir string) ([]MetaConfig, error) {
+	var metaConfigs []MetaConfig
+	err := filepath.Walk(dir, func(src string, file os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if file.IsDir() || !IsMetaConfigFile(file.Name()) {
+			return nil
+		}
+		jobs, err := cli.ReadJobsConfig(src)
+		if err != nil {
+			return err
+		}
+		metaConfigs = append(metaConfigs, MetaConfig{Path: src, JobsConfig: jobs})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walking through the meta config files failed: %v", err)
+	}
+	return metaConfigs, nil
+}
+
+// ValidateJobsConfigs validates all the meta configs and returns the problems found in any of them.
+func (cli *Client) ValidateJobsConfigs(metaConfigs []MetaConfig) error {
+	var err *multierror.Error
+	for _, mc := range metaConfigs {
+		err = multierror.Append(err, cli.ValidateJobConfig(filepath.Base(mc.Path), mc.JobsConfig))
+	}
+	return err.ErrorOrNil()
+}
+
+// GenerateJobConfigs converts the meta configs for all their branches. The job configs generated
+// from multiple meta config files for the same org/repo:branch are combined.
+func (cli *Client) GenerateJobConfigs(metaConfigs []MetaConfig) (map[Ref]config.JobConfig, error) {
+	output := map[Ref]config.JobConfig{}
+	for _, mc := range metaConfigs {
+		jobs := mc.JobsConfig
+		for _, branch := range jobs.Branches {
+			jc, err := cli.ConvertJobConfig(jobs, branch)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", mc.Path, err)
+			}
+			rf := Ref{Org: jobs.Org, Repo: jobs.Repo, Branch: branch}
+			if existing, ok := output[rf]; ok {
+				jc = combineJobConfigs(existing, jc, jobs.repoKey())
+			}
+			output[rf] = jc
+		}
+	}
+	return output, nil
+}
+
+// SortedRefs returns the refs of the generated job configs in order.
+func SortedRefs(output map[Ref]config.JobConfig) []Ref {
+	refs := make([]Ref, 0, len(output))
+	for r := range output {
+		refs = append(refs, r)
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].String() < refs[j].String()
+	})
+	return refs
+}
+
+func combineJobConfigs(jc1, jc2 config.JobConfig, repoKey string) config.JobConfig {
+	presubmits := jc1.PresubmitsStatic
+	postsubmits := jc1.PostsubmitsStatic
+	periodics := jc1.Periodics
+
+	presubmits[repoKey] = append(presubmits[repoKey], jc2.PresubmitsStatic[repoKey]...)
+	postsubmits[repoKey] = append(postsubmits[repoKey], jc2.PostsubmitsStatic[repoKey]...)
+	periodics = append(periodics, jc2.Periodics...)
+
+	return config.JobConfig{
+		PresubmitsStatic:  presubmits,
+		PostsubmitsStatic: postsubmits,
+		Periodics:         periodics,
+	}
+}
@@ -0,0 +1,305 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+const (
+	matrixInclude = "include"
+	matrixExclude = "exclude"
+)
+
+// Matrix configures the combinations of values a job referencing `$(matrix.<dimension>)` is
+// expanded to. It is written as a map of dimensions to their values, with the optional `include`
+// and `exclude` keys following the semantics of the GitHub Actions matrix:
+//   - an exclude entry removes the combinations matching all its values;
+//   - an include entry is merged into the combinations matching its values for the configured
+//     dimensions, or added as a new combination if there is none.
+type Matrix struct {
+	Dimensions map[string][]string
+	Include    []map[string]string
+	Exclude    []map[string]string
+}
+
+func (m *Matrix) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	m.Dimensions = map[string][]string{}
+	for k, v := range raw {
+		var err error
+		switch k {
+		case matrixInclude:
+			err = json.Unmarshal(v, &m.Include)
+		case matrixExclude:
+			err = json.Unmarshal(v, &m.Exclude)
+		default:
+			var values []string
+			err = json.Unmarshal(v, &values)
+			m.Dimensions[k] = values
+		}
+		if err != nil {
+			return fmt.Errorf("invalid matrix %s: %v", k, err)
+		}
+	}
+	return nil
+}
+
+func (m Matrix) MarshalJSON() ([]byte, error) {
+	raw := map[string]interface{}{}
+	for k, v := range m.Dimensions {
+		raw[k] = v
+	}
+	if len(m.Include) > 0 {
+		raw[matrixInclude] = m.Include
+	}
+	if len(m.Exclude) > 0 {
+		raw[matrixExclude] = m.Exclude
+	}
+	return json.Marshal(raw)
+}
+
+// override returns the matrix with the settings of the job matrix taking precedence. The
+// dimensions are overridden by name, the include and exclude entries are replaced when set.
+func (m *Matrix) override(job *Matrix) *Matrix {
+	if job == nil {
+		return m
+	}
+	res := &Matrix{Dimensions: map[string][]string{}}
+	if m != nil {
+		for k, v := range m.Dimensions {
+			res.Dimensions[k] = v
+		}
+		res.Include = m.Include
+		res.Exclude = m.Exclude
+	}
+	for k, v := range job.Dimensions {
+		res.Dimensions[k] = v
+	}
+	if job.Include != nil {
+		res.Include = job.Include
+	}
+	if job.Exclude != nil {
+		res.Exclude = job.Exclude
+	}
+	return res
+}
+
+// combinations returns the combinations of values for the dims referenced by a job. The first
+// dimension varies the slowest; the combinations added by include entries come last.
+func (m *Matrix) combinations(dims []string) ([]map[string]string, *ValidationError) {
+	if m == nil {
+		m = &Matrix{}
+	}
+
+	// The cartesian product of the referenced dimensions configured with values.
+	var configured []string
+	var combs []map[string]string
+	for _, dim := range dims {
+		values, ok := m.Dimensions[dim]
+		if !ok {
+			if !hasKey(m.Include, dim) {
+				return nil, newValidationError("", "", "matrix", "dimension %q is not configured in the matrix", dim)
+			}
+			continue
+		}
+		if len(configured) == 0 {
+			combs = []map[string]string{{}}
+		}
+		configured = append(configured, dim)
+		var next []map[string]string
+		for _, c := range combs {
+			for _, v := range values {
+				nc := map[string]string{dim: v}
+				for k, cv := range c {
+					nc[k] = cv
+				}
+				next = append(next, nc)
+			}
+		}
+		combs = next
+	}
+
+	// The exclude entries only apply if all their dimensions are referenced by the job, otherwise
+	// they would remove combinations the job does not vary on.
+	res := make([]map[string]string, 0, len(combs))
+	for _, c := range combs {
+		excluded := false
+		for _, e := range m.Exclude {
+			if len(e) > 0 && excludes(c, e) {
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			res = append(res, c)
+		}
+	}
+
+	original := len(res)
+	for _, entry := range m.Include {
+		e := map[string]string{}
+		for _, dim := range dims {
+			if v, ok := entry[dim]; ok {
+				e[dim] = v
+			}
+		}
+		if len(e) == 0 {
+			continue
+		}
+		merged := false
+		for _, c := range res[:original] {
+			if !matches(c, e, configured) {
+				continue
+			}
+			for k, v := range e {
+				if _, ok := c[k]; !ok {
+					c[k] = v
+				}
+			}
+			merged = true
+		}
+		if !merged {
+			res = append(res, e)
+		}
+	}
+
+	for _, c := range res {
+		for _, dim := range dims {
+			if _, ok := c[dim]; !ok {
+				return nil, newValidationError("", "", "matrix", "dimension %q is not set in the matrix combination %v", dim, c)
+			}
+		}
+	}
+	return res, nil
+}
+
+// matches returns whether the entry has the same values as the combination for the configured
+// dimensions, and does not conflict with the values merged in by previous include entries.
+func matches(comb, entry map[string]string, configured []string) bool {
+	for k, v := range entry {
+		cv, ok := comb[k]
+		if contains(configured, k) && cv != v || !contains(configured, k) && ok {
+			return false
+		}
+	}
+	return true
+}
+
+func excludes(comb, entry map[string]string) bool {
+	for k, v := range entry {
+		if cv, ok := comb[k]; !ok || cv != v {
+			return false
+		}
+	}
+	return true
+}
+
+func hasKey(entries []map[string]string, key string) bool {
+	for _, e := range entries {
+		if _, ok := e[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// applyMatrixJob expands the job with the matrix overridden by the job matrix. It returns the
+// expanded jobs with the matrix values each of them was expanded with, which are nil if the job does
+// not reference the matrix.
+func applyMatrixJob(job Job, matrix *Matrix) ([]Job, []map[string]string, error) {
+	matrix = matrix.override(job.Matrix)
+	job.Matrix = nil
+	yamlStr, err := yaml.Marshal(job)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal job %s: %v", job.Name, err)
+	}
+	expandedYamlStr, combs, verr := applyMatrix(string(yamlStr), matrix)
+	if verr != nil {
+		verr.Job = job.Name
+		return nil, nil, verr
+	}
+	jobs := make([]Job, 0)
+	for _, jobYaml := range expandedYamlStr {
+		expanded := &Job{}
+		if err := yaml.Unmarshal([]byte(jobYaml), expanded); err != nil {
+			return nil, nil, fmt.Errorf("failed to unmarshal the yaml to job %s: %v", job.Name, err)
+		}
+		jobs = append(jobs, *expanded)
+	}
+	return jobs, combs, nil
+}
+
+func applyMatrix(yamlStr string, matrix *Matrix) ([]string, []map[string]string, *ValidationError) {
+	var dims []string
+	for _, exp := range getVarSubstitutionExpressions(yamlStr) {
+		if strings.HasPrefix(exp, "matrix.") {
+			dims = append(dims, strings.TrimPrefix(exp, "matrix."))
+		}
+	}
+	if len(dims) == 0 {
+		return []string{yamlStr}, []map[string]string{nil}, nil
+	}
+
+	combs, verr := matrix.combinations(dims)
+	if verr != nil {
+		return nil, nil, verr
+	}
+	res := make([]string, 0, len(combs))
+	for _, c := range combs {
+		dest := yamlStr
+		for _, dim := range dims {
+			dest = replace(dest, dim, c[dim])
+		}
+		res = append(res, dest)
+	}
+	return res, combs, nil
+}
+
+// formatMatrixValues formats the matrix values of a job as dimension=value pairs, ordered by
+// dimension.
+func formatMatrixValues(values map[string]string) string {
+	dims := make([]string, 0, len(values))
+	for k := range values {
+		dims = append(dims, k)
+	}
+	sort.Strings(dims)
+	pairs := make([]string, 0, len(dims))
+	for _, k := range dims {
+		pairs = append(pairs, k+"="+values[k])
+	}
+	return strings.Join(pairs, ",")
+}
+
+func replace(str, expKey, expVal string) string {
+	return strings.ReplaceAll(str, "$(matrix."+expKey+")", expVal)
+}
@@ -0,0 +1,119 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ghodss/yaml"
+)
+
+func TestApplyMatrixJob(t *testing.T) {
+	matrix := `
+k8s: ["1.18", "1.19"]
+ip: [ipv4, ipv6]
+exclude:
+- k8s: "1.18"
+  ip: ipv6
+include:
+- k8s: "1.19"
+  arch: arm64
+- k8s: "1.20"
+  ip: ipv4
+`
+	m := &Matrix{}
+	if err := yaml.Unmarshal([]byte(matrix), m); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name     string
+		job      Job
+		expected []string
+		err      string
+	}{
+		{
+			name:     "no matrix reference",
+			job:      Job{Name: "unit"},
+			expected: []string{"unit"},
+		},
+		{
+			name:     "exclude and include",
+			job:      Job{Name: "e2e-$(matrix.k8s)-$(matrix.ip)"},
+			expected: []string{"e2e-1.18-ipv4", "e2e-1.19-ipv4", "e2e-1.19-ipv6", "e2e-1.20-ipv4"},
+		},
+		{
+			name:     "exclude with a dimension not referenced by the job",
+			job:      Job{Name: "e2e-$(matrix.k8s)"},
+			expected: []string{"e2e-1.18", "e2e-1.19", "e2e-1.20"},
+		},
+		{
+			name: "include does not set a referenced dimension for all combinations",
+			job:  Job{Name: "e2e-$(matrix.k8s)", Command: []string{"--arch=$(matrix.arch)"}},
+			err:  `job "e2e-$(matrix.k8s)": matrix: dimension "arch" is not set in the matrix combination map[k8s:1.18]`,
+		},
+		{
+			name: "job matrix override",
+			job: Job{
+				Name:   "e2e-$(matrix.k8s)-$(matrix.ip)",
+				Matrix: &Matrix{Dimensions: map[string][]string{"k8s": {"1.17"}}, Include: []map[string]string{}},
+			},
+			expected: []string{"e2e-1.17-ipv4", "e2e-1.17-ipv6"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			jobs, combs, err := applyMatrixJob(tc.job, m)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(combs) != len(jobs) {
+				t.Fatalf("expected the matrix values of the %d jobs, got %v", len(jobs), combs)
+			}
+			var actual []string
+			for _, j := range jobs {
+				actual = append(actual, j.Name)
+				if j.Matrix != nil {
+					t.Errorf("matrix of job %s is not cleared", j.Name)
+				}
+			}
+			if !reflect.DeepEqual(tc.expected, actual) {
+				t.Errorf("jobs do not match; actual: %v\n expected %v\n", actual, tc.expected)
+			}
+		})
+	}
+}
+
+func TestMatrixMarshal(t *testing.T) {
+	in := "exclude:\n- ip: ipv6\nip:\n- ipv4\n- ipv6\n"
+	m := &Matrix{}
+	if err := yaml.Unmarshal([]byte(in), m); err != nil {
+		t.Fatal(err)
+	}
+	out, err := yaml.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != in {
+		t.Errorf("matrix does not round trip; actual:\n%s\nexpected:\n%s", out, in)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+const (
+	// DefaultBranch is the default branch of the repos, unless the global config or the meta config
+	// sets another one.
+	DefaultBranch = "master"
+
+	// DefaultJobNameTemplate names the jobs <job>_<repo>, followed by the branch unless it is the
+	// default branch of the repo, and by the job type unless it is a presubmit, e.g.
+	// unit-tests_istio and unit-tests_istio_release-1.11_postsubmit.
+	DefaultJobNameTemplate = `{{.Job}}_{{.Repo}}{{if ne .Branch .DefaultBranch}}_{{.Branch}}{{end}}{{if ne .Type "presubmit"}}_{{.Type}}{{end}}`
+
+	// MaxJobNameLength is the maximum length of a Prow job name, as it is used as a label value of
+	// the Prow job and its pod.
+	MaxJobNameLength = 63
+)
+
+// JobNameVars are the variables of the job name template.
+type JobNameVars struct {
+	// Job is the name of the meta config job, with the matrix values substituted.
+	Job    string
+	Org    string
+	Repo   string
+	Branch string
+	// DefaultBranch is the default branch of the repo, e.g. master or main.
+	DefaultBranch string
+	// Type is the job type, one of presubmit, postsubmit and periodic.
+	Type string
+	// Matrix holds the matrix values the job is expanded with by dimension, e.g.
+	// {{index .Matrix "k8s"}}. It is empty if the job does not use the matrix.
+	Matrix map[string]string
+}
+
+// parseJobNameTemplate parses the job name template of the global config, or the default one if
+// it is not set.
+func parseJobNameTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		text = DefaultJobNameTemplate
+	}
+	tmpl, err := template.New("job_name_template").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid job name template: %v", err)
+	}
+	return tmpl, nil
+}
+
+// jobName generates the name of a Prow job with the template.
+func jobName(tmpl *template.Template, vars JobNameVars) (string, error) {
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, vars); err != nil {
+		return "", fmt.Errorf("failed to generate the name of job %s: %v", vars.Job, err)
+	}
+	if sb.Len() == 0 {
+		return "", fmt.Errorf("the name generated for job %s is empty", vars.Job)
+	}
+	return sb.String(), nil
+}
+
+// defaultBranch returns the default branch of the repo of the meta config.
+func (cli *Client) defaultBranch(jobsConfig JobsConfig) string {
+	if jobsConfig.DefaultBranch != "" {
+		return jobsConfig.DefaultBranch
+	}
+	if cli.GlobalConfig.DefaultBranch != "" {
+		return cli.GlobalConfig.DefaultBranch
+	}
+	return DefaultBranch
+}
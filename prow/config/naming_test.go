@@ -0,0 +1,163 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/hashicorp/go-multierror"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestJobNameTemplate(t *testing.T) {
+	jobs := JobsConfig{
+		Org:    "istio",
+		Repo:   "istio",
+		Image:  "foo",
+		Matrix: &Matrix{Dimensions: map[string][]string{"k8s": {"1.21", "1.22"}}},
+		Jobs: []Job{
+			{Name: "unit", Types: []string{TypePresubmit, TypePeriodic}, Cron: "0 0 * * *"},
+			{Name: "integ", Types: []string{TypePostsubmit}, Env: []v1.EnvVar{{Name: "K8S", Value: "$(matrix.k8s)"}}},
+		},
+	}
+	testCases := []struct {
+		name          string
+		template      string
+		defaultBranch string
+		branch        string
+		expected      []string
+	}{
+		{
+			name:     "default template",
+			branch:   "master",
+			expected: []string{"integ_istio_postsubmit", "integ_istio_postsubmit", "unit_istio", "unit_istio_periodic"},
+		},
+		{
+			name:     "default template on a release branch",
+			branch:   "release-1.11",
+			expected: []string{"integ_istio_release-1.11_postsubmit", "integ_istio_release-1.11_postsubmit", "unit_istio_release-1.11", "unit_istio_release-1.11_periodic"},
+		},
+		{
+			name:          "main default branch",
+			defaultBranch: "main",
+			branch:        "main",
+			expected:      []string{"integ_istio_postsubmit", "integ_istio_postsubmit", "unit_istio", "unit_istio_periodic"},
+		},
+		{
+			name:     "custom template",
+			template: `{{.Org}}-{{.Repo}}-{{.Job}}{{with index .Matrix "k8s"}}-k8s-{{.}}{{end}}-{{.Branch}}-{{.Type}}`,
+			branch:   "master",
+			expected: []string{"istio-istio-integ-k8s-1.21-master-postsubmit", "istio-istio-integ-k8s-1.22-master-postsubmit", "istio-istio-unit-master-periodic", "istio-istio-unit-master-presubmit"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cli := &Client{GlobalConfig: GlobalConfig{JobNameTemplate: tc.template, DefaultBranch: tc.defaultBranch}}
+			jc, err := cli.ConvertJobConfig(jobs, tc.branch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var actual []string
+			for _, ps := range jc.PresubmitsStatic["istio/istio"] {
+				actual = append(actual, ps.Name)
+			}
+			for _, ps := range jc.PostsubmitsStatic["istio/istio"] {
+				actual = append(actual, ps.Name)
+			}
+			for _, p := range jc.Periodics {
+				actual = append(actual, p.Name)
+			}
+			sort.Strings(actual)
+			if !reflect.DeepEqual(tc.expected, actual) {
+				t.Errorf("job names do not match; actual: %v\n expected %v\n", actual, tc.expected)
+			}
+		})
+	}
+
+	cli := &Client{GlobalConfig: GlobalConfig{JobNameTemplate: "{{.Job"}}
+	if _, err := cli.ConvertJobConfig(jobs, "master"); err == nil {
+		t.Error("expected an error for an invalid job name template")
+	}
+}
+
+func TestValidateJobNameLength(t *testing.T) {
+	jobs := JobsConfig{
+		Org:      "istio",
+		Repo:     "istio",
+		Branches: []string{"master", "release-1.11"},
+		Jobs:     []Job{{Name: "integ-security-istiodless-multicluster-tests", Image: "foo", Types: []string{TypePresubmit, TypePostsubmit}}},
+	}
+	testCases := []struct {
+		name     string
+		template string
+		expected []ValidationError
+	}{
+		{
+			name: "default template",
+			expected: []ValidationError{
+				{File: "test.yaml", Job: "integ-security-istiodless-multicluster-tests", Field: "name",
+					Message: "generated postsubmit job name integ-security-istiodless-multicluster-tests_istio_release-1.11_postsubmit is longer than 63 characters"},
+			},
+		},
+		{
+			name:     "short template",
+			template: "{{.Job}}",
+		},
+		{
+			name:     "custom template",
+			template: "{{.Job}}_{{.Branch}}_{{.Type}}",
+			expected: []ValidationError{
+				{File: "test.yaml", Job: "integ-security-istiodless-multicluster-tests", Field: "name",
+					Message: "generated presubmit job name integ-security-istiodless-multicluster-tests_release-1.11_presubmit is longer than 63 characters"},
+				{File: "test.yaml", Job: "integ-security-istiodless-multicluster-tests", Field: "name",
+					Message: "generated postsubmit job name integ-security-istiodless-multicluster-tests_release-1.11_postsubmit is longer than 63 characters"},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cli := &Client{GlobalConfig: GlobalConfig{JobNameTemplate: tc.template}}
+			err := cli.ValidateJobConfig("test.yaml", jobs)
+			if len(tc.expected) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			merr, ok := err.(*multierror.Error)
+			if !ok {
+				t.Fatalf("expected a multierror, got %v", err)
+			}
+			var actual []ValidationError
+			for _, e := range merr.Errors {
+				ve, ok := e.(*ValidationError)
+				if !ok {
+					t.Fatalf("expected a ValidationError, got %v", e)
+				}
+				actual = append(actual, *ve)
+			}
+			if !reflect.DeepEqual(tc.expected, actual) {
+				t.Errorf("validation errors do not match; actual: %v\n expected %v\n", actual, tc.expected)
+			}
+		})
+	}
+
+	jobs.Jobs[0].AllowLongName = true
+	if err := (&Client{}).ValidateJobConfig("test.yaml", jobs); err != nil {
+		t.Errorf("unexpected error for a job allowing a long name: %v", err)
+	}
+}
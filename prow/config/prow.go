@@ -0,0 +1,191 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/test-infra/prow/config"
+)
+
+// origin is the meta config job a Prow job is generated from.
+type origin struct {
+	file string
+	job  string
+}
+
+// prowValidator runs the checks Prow does not do on the generated jobs, and records the origin of
+// each of them.
+type prowValidator struct {
+	// clusters holds the known clusters, it is nil if any cluster is allowed.
+	clusters map[string]bool
+	origins  map[string][]origin
+	// seen holds the origin of the jobs by their type, scope and name, to find the duplicates.
+	seen map[string]origin
+	errs *multierror.Error
+}
+
+// ValidateProwConfig generates the Prow jobs of the meta configs, and loads them together with the
+// Prow config file through the Prow config loading, defaulting and validation. The jobs must also
+// run in a cluster listed in the global config, if it lists any. The errors are reported for the
+// meta config file and job the Prow job is generated from.
+func (cli *Client) ValidateProwConfig(prowConfig string, metaConfigs []MetaConfig) error {
+	v := &prowValidator{
+		origins: map[string][]origin{},
+		seen:    map[string]origin{},
+	}
+	if len(cli.GlobalConfig.Clusters) > 0 {
+		v.clusters = map[string]bool{DefaultCluster: true}
+		for _, c := range cli.GlobalConfig.Clusters {
+			v.clusters[c] = true
+		}
+	}
+
+	// The jobs are converted one by one to know their origin. The jobs failing the checks done here
+	// are left out of the config loaded by Prow, as it stops at the first defaulting error.
+	output := map[Ref]config.JobConfig{}
+	for _, mc := range metaConfigs {
+		jobs := mc.JobsConfig
+		file := filepath.Base(mc.Path)
+		orgRepo := fmt.Sprintf("%s/%s", jobs.Org, jobs.Repo)
+		key := jobs.repoKey()
+		for _, branch := range jobs.Branches {
+			rf := Ref{Org: jobs.Org, Repo: jobs.Repo, Branch: branch}
+			scope := orgRepo + ":" + branch
+			for _, parentJob := range jobs.Jobs {
+				single := jobs
+				single.Jobs = []Job{parentJob}
+				jc, err := cli.ConvertJobConfig(single, branch)
+				if err != nil {
+					v.errs = multierror.Append(v.errs, fmt.Errorf("%s: %v", file, err))
+					continue
+				}
+				o := origin{file: file, job: parentJob.Name}
+
+				checked := config.JobConfig{
+					PresubmitsStatic:  map[string][]config.Presubmit{},
+					PostsubmitsStatic: map[string][]config.Postsubmit{},
+					Periodics:         []config.Periodic{},
+				}
+				for _, p := range jc.PresubmitsStatic[key] {
+					err := config.SetPresubmitRegexes([]config.Presubmit{p})
+					if v.check(o, TypePresubmit, scope, p.JobBase, err) {
+						checked.PresubmitsStatic[key] = append(checked.PresubmitsStatic[key], p)
+					}
+				}
+				for _, p := range jc.PostsubmitsStatic[key] {
+					err := config.SetPostsubmitRegexes([]config.Postsubmit{p})
+					if v.check(o, TypePostsubmit, scope, p.JobBase, err) {
+						checked.PostsubmitsStatic[key] = append(checked.PostsubmitsStatic[key], p)
+					}
+				}
+				for _, p := range jc.Periodics {
+					if v.check(o, TypePeriodic, "", p.JobBase, nil) {
+						checked.Periodics = append(checked.Periodics, p)
+					}
+				}
+				if existing, ok := output[rf]; ok {
+					checked = combineJobConfigs(existing, checked, key)
+				}
+				output[rf] = checked
+			}
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "prow-jobs")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	for r, jc := range output {
+		fname := filepath.Join(dir, filepath.Base(r.FileName(dir)))
+		if err := cli.WriteConfig(jc, fname); err != nil {
+			return err
+		}
+	}
+	if _, err := config.Load(prowConfig, dir, nil, ""); err != nil {
+		v.addProwErrors(err)
+	}
+	return v.errs.ErrorOrNil()
+}
+
+// check validates the generated job and records its origin. It returns whether the job should be
+// loaded by Prow, i.e. whether it is not a duplicate and its regexes compile.
+func (v *prowValidator) check(o origin, jobType, scope string, job config.JobBase, regexErr error) bool {
+	v.origins[job.Name] = append(v.origins[job.Name], o)
+
+	if v.clusters != nil && job.Cluster != "" && !v.clusters[job.Cluster] {
+		v.errs = multierror.Append(v.errs, newValidationError(o.file, o.job, "cluster",
+			"generated %s job %s runs in unknown cluster %q", jobType, job.Name, job.Cluster))
+	}
+	if regexErr != nil {
+		v.errs = multierror.Append(v.errs, newValidationError(o.file, o.job, "regex", "%v", regexErr))
+		return false
+	}
+
+	key := strings.Join([]string{jobType, scope, job.Name}, "|")
+	if existing, ok := v.seen[key]; ok {
+		v.errs = multierror.Append(v.errs, newValidationError(o.file, o.job, "name",
+			"duplicated %s job %s, also generated from %s job %q", jobType, job.Name, existing.file, existing.job))
+		return false
+	}
+	v.seen[key] = o
+	return true
+}
+
+// addProwErrors adds the errors returned by Prow, for the origins of the jobs they name.
+func (v *prowValidator) addProwErrors(err error) {
+	errs := []error{err}
+	var agg utilerrors.Aggregate
+	if errors.As(err, &agg) {
+		errs = utilerrors.Flatten(agg).Errors()
+	}
+	for _, e := range errs {
+		var origins []origin
+		for _, word := range strings.FieldsFunc(e.Error(), isNotJobNameChar) {
+			for _, o := range v.origins[word] {
+				if !containsOrigin(origins, o) {
+					origins = append(origins, o)
+				}
+			}
+		}
+		if len(origins) == 0 {
+			v.errs = multierror.Append(v.errs, fmt.Errorf("prow: %v", e))
+		}
+		for _, o := range origins {
+			v.errs = multierror.Append(v.errs, newValidationError(o.file, o.job, "prow", "%v", e))
+		}
+	}
+}
+
+func isNotJobNameChar(r rune) bool {
+	return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.')
+}
+
+func containsOrigin(origins []origin, o origin) bool {
+	for _, e := range origins {
+		if e == o {
+			return true
+		}
+	}
+	return false
+}
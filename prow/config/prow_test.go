@@ -0,0 +1,117 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+func TestValidateProwConfig(t *testing.T) {
+	cli := &Client{GlobalConfig: GlobalConfig{Clusters: []string{"trusted"}}}
+	metaConfig := func(file string, jobs ...Job) MetaConfig {
+		for i := range jobs {
+			jobs[i].Image = "foo"
+			jobs[i].Command = []string{"make", "test"}
+		}
+		return MetaConfig{Path: "jobs/" + file, JobsConfig: JobsConfig{
+			Org:      "istio",
+			Repo:     "istio",
+			Branches: []string{"master"},
+			Jobs:     jobs,
+		}}
+	}
+	testCases := []struct {
+		name        string
+		metaConfigs []MetaConfig
+		expected    []ValidationError
+	}{
+		{
+			name: "valid config",
+			metaConfigs: []MetaConfig{
+				metaConfig("a.yaml", Job{Name: "unit", Regex: `\.go$`}, Job{Name: "deploy", Types: []string{TypePostsubmit}, Cluster: "trusted"}),
+				metaConfig("b.yaml", Job{Name: "lint"}),
+			},
+		},
+		{
+			name: "duplicated job across files",
+			metaConfigs: []MetaConfig{
+				metaConfig("a.yaml", Job{Name: "unit", Types: []string{TypePresubmit}}),
+				metaConfig("b.yaml", Job{Name: "unit", Types: []string{TypePresubmit}}),
+			},
+			expected: []ValidationError{
+				{File: "b.yaml", Job: "unit", Field: "name", Message: `duplicated presubmit job unit_istio, also generated from a.yaml job "unit"`},
+			},
+		},
+		{
+			name: "invalid regex",
+			metaConfigs: []MetaConfig{
+				metaConfig("a.yaml", Job{Name: "unit", Types: []string{TypePresubmit}, Regex: "[a-z"}),
+			},
+			expected: []ValidationError{
+				{File: "a.yaml", Job: "unit", Field: "regex",
+					Message: "could not set change regexes for unit_istio: could not compile run_if_changed regex: error parsing regexp: missing closing ]: `[a-z`"},
+			},
+		},
+		{
+			name: "unknown cluster",
+			metaConfigs: []MetaConfig{
+				metaConfig("a.yaml", Job{Name: "unit", Types: []string{TypePresubmit}, Cluster: "untrusted"}),
+			},
+			expected: []ValidationError{
+				{File: "a.yaml", Job: "unit", Field: "cluster", Message: `generated presubmit job unit_istio runs in unknown cluster "untrusted"`},
+			},
+		},
+		{
+			name: "invalid job reported by prow",
+			metaConfigs: []MetaConfig{
+				metaConfig("a.yaml", Job{Name: "unit", Types: []string{TypePresubmit}}),
+				metaConfig("b.yaml", Job{Name: "lint", Types: []string{TypePresubmit}, MaxConcurrency: -1}),
+			},
+			expected: []ValidationError{
+				{File: "b.yaml", Job: "lint", Field: "prow", Message: "invalid presubmit job lint_istio: max_concurrency: -1 must be a non-negative number"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := cli.ValidateProwConfig("testdata/prow-config.yaml", tc.metaConfigs)
+			if len(tc.expected) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			merr, ok := err.(*multierror.Error)
+			if !ok {
+				t.Fatalf("expected a multierror, got %v", err)
+			}
+			var actual []ValidationError
+			for _, e := range merr.Errors {
+				ve, ok := e.(*ValidationError)
+				if !ok {
+					t.Fatalf("expected a ValidationError, got %v", e)
+				}
+				actual = append(actual, *ve)
+			}
+			if !reflect.DeepEqual(tc.expected, actual) {
+				t.Errorf("validation errors do not match; actual: %v\n expected %v\n", actual, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// DefaultCluster is the cluster Prow runs the jobs without a cluster in.
+const DefaultCluster = "default"
+
+// ResolvedJob is a meta config job with the global and repo level settings merged in, and the
+// matrix expanded.
+type ResolvedJob struct {
+	File     string   `json:"file"`
+	Org      string   `json:"org"`
+	Repo     string   `json:"repo"`
+	Branches []string `json:"branches"`
+	Job      Job      `json:"job"`
+	// Matrix holds the matrix values the job is expanded with.
+	Matrix map[string]string `json:"matrix,omitempty"`
+	// ProwJobs are the names of the Prow jobs generated from the job, for each branch and type.
+	ProwJobs []string `json:"prow_jobs"`
+}
+
+// ResolveJobs returns the resolved jobs of the meta configs. Besides the settings merged by
+// ReadJobsConfig, the requirements required by the job requirements are added, and the defaults for
+// the job types, resource preset and cluster are filled in. The resource preset can be set by the
+// requirements of the job.
+func (cli *Client) ResolveJobs(metaConfigs []MetaConfig) ([]ResolvedJob, error) {
+	tmpl, err := parseJobNameTemplate(cli.GlobalConfig.JobNameTemplate)
+	if err != nil {
+		return nil, err
+	}
+	var res []ResolvedJob
+	for _, mc := range metaConfigs {
+		jobsConfig := mc.JobsConfig
+		defaultBranch := cli.defaultBranch(jobsConfig)
+		branches := jobsConfig.Branches
+		if len(branches) == 0 {
+			branches = []string{defaultBranch}
+		}
+		for _, parentJob := range jobsConfig.Jobs {
+			expandedJobs, combs, err := applyMatrixJob(parentJob, jobsConfig.Matrix)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", mc.Path, err)
+			}
+			for i, job := range expandedJobs {
+				job.Requirements, err = expandRequirements(job.Requirements, jobsConfig.RequirementPresets)
+				if err != nil {
+					return nil, fmt.Errorf("%s: job %s: %v", mc.Path, job.Name, err)
+				}
+				if len(job.Types) == 0 {
+					job.Types = []string{TypePresubmit, TypePostsubmit}
+				}
+				if job.Resource == "" {
+					r := resourcePreset(job, jobsConfig.RequirementPresets)
+					if _, ok := jobsConfig.ResourcePresets[r]; ok {
+						job.Resource = r
+					}
+				}
+				if job.Cluster == "" {
+					job.Cluster = DefaultCluster
+				}
+				var prowJobs []string
+				for _, branch := range branches {
+					for _, t := range job.Types {
+						name, err := jobName(tmpl, JobNameVars{
+							Job: job.Name, Org: jobsConfig.Org, Repo: jobsConfig.Repo, Branch: branch,
+							DefaultBranch: defaultBranch, Type: t, Matrix: combs[i],
+						})
+						if err != nil {
+							return nil, fmt.Errorf("%s: %v", mc.Path, err)
+						}
+						prowJobs = append(prowJobs, name)
+					}
+				}
+				res = append(res, ResolvedJob{
+					File:     mc.Path,
+					Org:      jobsConfig.Org,
+					Repo:     jobsConfig.Repo,
+					Branches: jobsConfig.Branches,
+					Job:      job,
+					Matrix:   combs[i],
+					ProwJobs: prowJobs,
+				})
+			}
+		}
+	}
+	return res, nil
+}
+
+// JobQuery selects resolved jobs. The zero value of each field matches all the jobs.
+type JobQuery struct {
+	// Name matches the name of one of the Prow jobs generated from the job.
+	Name *regexp.Regexp
+	// Requirements must all be required by the job.
+	Requirements []string
+	Resource     string
+	Cluster      string
+	Type         string
+	Modifier     string
+	// Image matches the job image.
+	Image *regexp.Regexp
+	// Labels must all be set on the job. An empty value matches any value of the label.
+	Labels map[string]string
+}
+
+// Matches returns whether the job is selected by the query.
+func (q JobQuery) Matches(j ResolvedJob) bool {
+	job := j.Job
+	if q.Name != nil && !anyMatch(q.Name, j.ProwJobs) {
+		return false
+	}
+	if !sets.NewString(job.Requirements...).HasAll(q.Requirements...) {
+		return false
+	}
+	if q.Resource != "" && job.Resource != q.Resource {
+		return false
+	}
+	if q.Cluster != "" && job.Cluster != q.Cluster {
+		return false
+	}
+	if q.Type != "" && !sets.NewString(job.Types...).Has(q.Type) {
+		return false
+	}
+	if q.Modifier != "" && !sets.NewString(job.Modifiers...).Has(q.Modifier) {
+		return false
+	}
+	if q.Image != nil && !q.Image.MatchString(job.Image) {
+		return false
+	}
+	for k, v := range q.Labels {
+		actual, ok := job.Labels[k]
+		if !ok || v != "" && actual != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Filter returns the jobs selected by the query.
+func (q JobQuery) Filter(jobs []ResolvedJob) []ResolvedJob {
+	var res []ResolvedJob
+	for _, j := range jobs {
+		if q.Matches(j) {
+			res = append(res, j)
+		}
+	}
+	return res
+}
+
+func anyMatch(re *regexp.Regexp, values []string) bool {
+	for _, v := range values {
+		if re.MatchString(v) {
+			return true
+		}
+	}
+	return false
+}
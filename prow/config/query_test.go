@@ -0,0 +1,89 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestQueryJobs(t *testing.T) {
+	settings, err := ReadGlobalSettings("testdata/.global.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli := &Client{GlobalConfig: settings}
+	var metaConfigs []MetaConfig
+	for _, f := range []string{"testdata/simple.yaml", "testdata/simple-matrix.yaml"} {
+		jobs, err := cli.ReadJobsConfig(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		metaConfigs = append(metaConfigs, MetaConfig{Path: f, JobsConfig: jobs})
+	}
+	jobs, err := cli.ResolveJobs(metaConfigs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name     string
+		query    JobQuery
+		expected []string
+	}{
+		{
+			name:     "requirement from the repo and global config",
+			query:    JobQuery{Requirements: []string{"cache", "gocache"}, Type: TypePeriodic},
+			expected: []string{"periodic-job"},
+		},
+		{
+			name:     "requirement from the matrix",
+			query:    JobQuery{Requirements: []string{"gcloud"}, Name: regexp.MustCompile("arg1")},
+			expected: []string{"test-gcloud-arg1-val1", "test-gcloud-arg1-val2"},
+		},
+		{
+			name:     "generated job name",
+			query:    JobQuery{Name: regexp.MustCompile("^test_istio_postsubmit$|_periodic$")},
+			expected: []string{"test", "periodic-job"},
+		},
+		{
+			name:     "resource preset",
+			query:    JobQuery{Resource: "custom"},
+			expected: []string{"presubmit-kind"},
+		},
+		{
+			name:     "default resource and cluster",
+			query:    JobQuery{Resource: DefaultResource, Cluster: DefaultCluster, Type: TypePresubmit, Image: regexp.MustCompile("^foo")},
+			expected: []string{"test-paths", "lint-paths", "manual", "custom-node-selector"},
+		},
+		{
+			name:     "annotation is not a label",
+			query:    JobQuery{Labels: map[string]string{"whatever-annotation-name": ""}},
+			expected: nil,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var actual []string
+			for _, j := range tc.query.Filter(jobs) {
+				actual = append(actual, j.Job.Name)
+			}
+			if !reflect.DeepEqual(tc.expected, actual) {
+				t.Errorf("jobs do not match; actual: %v\n expected %v\n", actual, tc.expected)
+			}
+		})
+	}
+}
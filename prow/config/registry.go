@@ -0,0 +1,132 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/google"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// Registry tags and lists the images of a container registry.
+type Registry interface {
+	// Tag makes the image dst refer to the same image as src. src is a full image reference, by
+	// tag and/or digest, e.g. gcr.io/istio-testing/build-tools:master-2021-07-14T19-43-48, and dst
+	// a tag in the same repository.
+	Tag(src, dst string) error
+	// Digest returns the digest of the image, e.g. sha256:0123...
+	Digest(image string) (string, error)
+	// ListTags returns the tags of the repository, e.g. gcr.io/istio-testing/build-tools.
+	ListTags(repository string) ([]string, error)
+}
+
+// OCIRegistry accesses any registry implementing the OCI distribution API.
+type OCIRegistry struct {
+	// Options are passed to the registry calls, e.g. remote.WithAuth.
+	Options []remote.Option
+}
+
+// NewOCIRegistry returns a registry authenticating with the docker config and the gcloud
+// credentials, so that both gcr.io and other registries can be used.
+func NewOCIRegistry() *OCIRegistry {
+	return &OCIRegistry{
+		Options: []remote.Option{
+			remote.WithAuthFromKeychain(authn.NewMultiKeychain(authn.DefaultKeychain, google.Keychain)),
+		},
+	}
+}
+
+func (r *OCIRegistry) Tag(src, dst string) error {
+	srcRef, err := name.ParseReference(src)
+	if err != nil {
+		return fmt.Errorf("invalid image %s: %v", src, err)
+	}
+	dstTag, err := name.NewTag(dst)
+	if err != nil {
+		return fmt.Errorf("invalid image tag %s: %v", dst, err)
+	}
+	desc, err := remote.Get(srcRef, r.Options...)
+	if err != nil {
+		return fmt.Errorf("unable to get image %s: %v", src, err)
+	}
+	if err := remote.Tag(dstTag, desc, r.Options...); err != nil {
+		return fmt.Errorf("unable to add image tag %s: %v", dst, err)
+	}
+	return nil
+}
+
+func (r *OCIRegistry) Digest(image string) (string, error) {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return "", fmt.Errorf("invalid image %s: %v", image, err)
+	}
+	desc, err := remote.Head(ref, r.Options...)
+	if err != nil {
+		return "", fmt.Errorf("unable to get the digest of image %s: %v", image, err)
+	}
+	return desc.Digest.String(), nil
+}
+
+func (r *OCIRegistry) ListTags(repository string) ([]string, error) {
+	repo, err := name.NewRepository(repository)
+	if err != nil {
+		return nil, fmt.Errorf("invalid repository %s: %v", repository, err)
+	}
+	tags, err := remote.List(repo, r.Options...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the tags of %s: %v", repository, err)
+	}
+	return tags, nil
+}
+
+// imageRef is an image reference split into its repository, tag and digest, e.g.
+// gcr.io/istio-testing/build-tools:master-2021-07-14T19-43-48@sha256:0123...
+type imageRef struct {
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// parseImage splits the image reference, which must be valid, into its repository, tag and
+// digest. The tag and digest are empty if not set.
+func parseImage(image string) (imageRef, error) {
+	if _, err := name.ParseReference(image); err != nil {
+		return imageRef{}, err
+	}
+	ref := imageRef{Repository: image}
+	if i := strings.LastIndex(ref.Repository, "@"); i >= 0 {
+		ref.Repository, ref.Digest = ref.Repository[:i], ref.Repository[i+1:]
+	}
+	// A colon after the last slash separates the tag, the other ones are the registry port.
+	if i := strings.LastIndex(ref.Repository, ":"); i > strings.LastIndex(ref.Repository, "/") {
+		ref.Repository, ref.Tag = ref.Repository[:i], ref.Repository[i+1:]
+	}
+	return ref, nil
+}
+
+func (r imageRef) String() string {
+	s := r.Repository
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
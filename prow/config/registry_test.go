@@ -0,0 +1,100 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// startRegistry starts a local registry and returns its host, and the function stopping it.
+func startRegistry() (string, func()) {
+	s := httptest.NewServer(registry.New(registry.Logger(log.New(ioutil.Discard, "", 0))))
+	return strings.TrimPrefix(s.URL, "http://"), s.Close
+}
+
+// pushImage pushes a random image to the local registry and returns its digest.
+func pushImage(t *testing.T, image string) string {
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return digest.String()
+}
+
+func TestOCIRegistry(t *testing.T) {
+	host, stop := startRegistry()
+	defer stop()
+	src := host + "/istio-testing/build-tools:master-2021-07-14T19-43-48"
+	digest := pushImage(t, src)
+	r := NewOCIRegistry()
+
+	testCases := []struct {
+		name string
+		src  string
+		dst  string
+	}{
+		{
+			name: "by tag",
+			src:  src,
+			dst:  host + "/istio-testing/build-tools:release-1.12-2021-07-14T19-43-48",
+		},
+		{
+			name: "by digest",
+			src:  src + "@" + digest,
+			dst:  host + "/istio-testing/build-tools:release-1.13-2021-07-14T19-43-48",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := r.Tag(tc.src, tc.dst); err != nil {
+				t.Fatal(err)
+			}
+			actual, err := r.Digest(tc.dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual != digest {
+				t.Errorf("digest does not match; actual: %s\n expected %s\n", actual, digest)
+			}
+		})
+	}
+
+	if err := r.Tag(host+"/istio-testing/unknown:master", host+"/istio-testing/unknown:release-1.12"); err == nil {
+		t.Error("expected an error for an unknown image")
+	}
+	if _, err := r.Digest(host + "/istio-testing/unknown:master"); err == nil {
+		t.Error("expected an error for an unknown image")
+	}
+}
@@ -15,6 +15,10 @@
 package config
 
 import (
+	"fmt"
+	"reflect"
+	"strings"
+
 	v1 "k8s.io/api/core/v1"
 )
 
@@ -25,61 +29,273 @@ type RequirementPreset struct {
 	Env          []v1.EnvVar       `json:"env"`
 	Volumes      []v1.Volume       `json:"volumes"`
 	VolumeMounts []v1.VolumeMount  `json:"volumeMounts"`
+	// Privileged runs the containers in privileged mode, e.g. for running docker.
+	Privileged bool `json:"privileged,omitempty"`
+	// The scheduling settings are added to the pod. The affinity and priority class of the job
+	// take precedence.
+	Tolerations               []v1.Toleration               `json:"tolerations,omitempty"`
+	Affinity                  *v1.Affinity                  `json:"affinity,omitempty"`
+	TopologySpreadConstraints []v1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+	PriorityClassName         string                        `json:"priorityClassName,omitempty"`
+	// The node selector is added to the one of the job, which takes precedence.
+	NodeSelector       map[string]string `json:"nodeSelector,omitempty"`
+	ServiceAccountName string            `json:"serviceAccountName,omitempty"`
+	// Resource is the resource preset of the jobs not setting one.
+	Resource string `json:"resources,omitempty"`
+	// Repos are the extra repos cloned for the job, in the same format as the job repos.
+	Repos []string `json:"repos,omitempty"`
+	// Requires are the names of the presets required by this one, e.g. kind requires docker. The
+	// required presets are applied first, so that the settings of this one take precedence.
+	Requires []string `json:"requires,omitempty"`
+	// Containers are the names of the containers the env and volume mounts are added to, which
+	// can be the sidecars, the init containers or the test container. Defaults to the test container.
+	// Privileged applies to the same containers.
+	Containers []string `json:"containers,omitempty"`
+}
+
+// targets returns whether the env and volume mounts of the preset are added to the container.
+func (r RequirementPreset) targets(container string) bool {
+	if len(r.Containers) == 0 {
+		return container == TestContainerName
+	}
+	return contains(r.Containers, container)
 }
 
 func resolveRequirements(annotations, labels map[string]string, spec *v1.PodSpec, requirements []RequirementPreset) {
 	if spec != nil {
 		for _, req := range requirements {
-			mergeRequirement(req, annotations, labels, spec.Containers, &spec.Volumes)
+			mergeRequirement(req, annotations, labels, spec)
 		}
 	}
 }
 
-func mergeRequirement(req RequirementPreset, annotations, labels map[string]string, containers []v1.Container, volumes *[]v1.Volume) {
+func mergeRequirement(req RequirementPreset, annotations, labels map[string]string, spec *v1.PodSpec) {
 	for a, v := range req.Annotations {
 		annotations[a] = v
 	}
 	for l, v := range req.Labels {
 		labels[l] = v
 	}
-	for _, e1 := range req.Env {
-		for i := range containers {
+	for _, vl1 := range req.Volumes {
+		exists := false
+		for _, vl2 := range spec.Volumes {
+			if vl2.Name == vl1.Name {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			spec.Volumes = append(spec.Volumes, vl1)
+		}
+	}
+	mergeScheduling(req, spec)
+
+	var containers []*v1.Container
+	for i := range spec.Containers {
+		name := spec.Containers[i].Name
+		if i == 0 {
+			// The test container is only named if the job has sidecars.
+			name = TestContainerName
+		}
+		if req.targets(name) {
+			containers = append(containers, &spec.Containers[i])
+		}
+	}
+	for i := range spec.InitContainers {
+		if req.targets(spec.InitContainers[i].Name) {
+			containers = append(containers, &spec.InitContainers[i])
+		}
+	}
+	for _, c := range containers {
+		if req.Privileged {
+			if c.SecurityContext == nil {
+				c.SecurityContext = &v1.SecurityContext{}
+			}
+			c.SecurityContext.Privileged = newTrue()
+		}
+		// The env is merged by createContainer and createInitContainers.
+		for _, vm1 := range req.VolumeMounts {
 			exists := false
-			for _, e2 := range containers[i].Env {
-				if e2.Name == e1.Name {
+			for _, vm2 := range c.VolumeMounts {
+				if vm2.MountPath == vm1.MountPath {
 					exists = true
 					break
 				}
 			}
 			if !exists {
-				containers[i].Env = append(containers[i].Env, e1)
+				c.VolumeMounts = append(c.VolumeMounts, vm1)
 			}
 		}
 	}
-	for _, vl1 := range req.Volumes {
+}
+
+func mergeScheduling(req RequirementPreset, spec *v1.PodSpec) {
+	for _, t1 := range req.Tolerations {
 		exists := false
-		for _, vl2 := range *volumes {
-			if vl2.Name == vl1.Name {
+		for _, t2 := range spec.Tolerations {
+			if reflect.DeepEqual(t1, t2) {
 				exists = true
 				break
 			}
 		}
 		if !exists {
-			*volumes = append(*volumes, vl1)
+			spec.Tolerations = append(spec.Tolerations, t1)
 		}
 	}
-	for _, vm1 := range req.VolumeMounts {
-		for i := range containers {
+	for _, c1 := range req.TopologySpreadConstraints {
+		exists := false
+		for _, c2 := range spec.TopologySpreadConstraints {
+			if c2.TopologyKey == c1.TopologyKey && reflect.DeepEqual(c2.LabelSelector, c1.LabelSelector) {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			spec.TopologySpreadConstraints = append(spec.TopologySpreadConstraints, c1)
+		}
+	}
+	if req.Affinity != nil {
+		if spec.Affinity == nil {
+			spec.Affinity = &v1.Affinity{}
+		}
+		if spec.Affinity.NodeAffinity == nil {
+			spec.Affinity.NodeAffinity = req.Affinity.NodeAffinity.DeepCopy()
+		}
+		if spec.Affinity.PodAffinity == nil {
+			spec.Affinity.PodAffinity = req.Affinity.PodAffinity.DeepCopy()
+		}
+		if spec.Affinity.PodAntiAffinity == nil {
+			spec.Affinity.PodAntiAffinity = req.Affinity.PodAntiAffinity.DeepCopy()
+		}
+	}
+	if spec.PriorityClassName == "" {
+		spec.PriorityClassName = req.PriorityClassName
+	}
+	if len(req.NodeSelector) > 0 {
+		// The node selector of the job is shared with the other jobs.
+		spec.NodeSelector = mergeMaps(req.NodeSelector, spec.NodeSelector)
+	}
+	if spec.ServiceAccountName == "" {
+		spec.ServiceAccountName = req.ServiceAccountName
+	}
+}
+
+// resourcePreset returns the name of the resource preset of the job. If the job does not set one,
+// the one of its last requirement setting it is used, then the default one.
+func resourcePreset(job Job, presets map[string]RequirementPreset) string {
+	if job.Resource != "" {
+		return job.Resource
+	}
+	res := DefaultResource
+	for _, req := range job.Requirements {
+		if r := presets[req].Resource; r != "" {
+			res = r
+		}
+	}
+	return res
+}
+
+// requiredRepos returns the extra repos of the job, followed by the ones of its requirements. A
+// repo is only cloned once, at the branch of its first occurrence.
+func requiredRepos(job Job, presets map[string]RequirementPreset) []string {
+	repos := append([]string{}, job.Repos...)
+	for _, req := range job.Requirements {
+		for _, r1 := range presets[req].Repos {
 			exists := false
-			for _, vm2 := range containers[i].VolumeMounts {
-				if vm2.MountPath == vm1.MountPath {
+			for _, r2 := range repos {
+				if strings.Split(r2, "@")[0] == strings.Split(r1, "@")[0] {
 					exists = true
 					break
 				}
 			}
 			if !exists {
-				containers[i].VolumeMounts = append(containers[i].VolumeMounts, vm1)
+				repos = append(repos, r1)
+			}
+		}
+	}
+	return repos
+}
+
+// expandRequirements returns the requirements together with the ones they require, recursively.
+// The required presets come before the presets requiring them. The unknown requirements of the job
+// are kept as is, since they are reported by the validation.
+func expandRequirements(requirements []string, presets map[string]RequirementPreset) ([]string, error) {
+	var res []string
+	var expand func(name string, chain []string) error
+	expand = func(name string, chain []string) error {
+		if contains(chain, name) {
+			return fmt.Errorf("requirements require each other in a cycle: %s", strings.Join(append(chain, name), " -> "))
+		}
+		if contains(res, name) {
+			return nil
+		}
+		preset, ok := presets[name]
+		if !ok && len(chain) > 0 {
+			return fmt.Errorf("requirement %s requires nonexistent requirement %s", chain[len(chain)-1], name)
+		}
+		for _, req := range preset.Requires {
+			if err := expand(req, append(chain, name)); err != nil {
+				return err
+			}
+		}
+		res = append(res, name)
+		return nil
+	}
+	for _, req := range requirements {
+		if err := expand(req, nil); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// requirementConflicts returns the descriptions of the volumes, volume mounts and env defined
+// differently by the requirements, which would be silently ignored by all but the first of them.
+func requirementConflicts(requirements []string, presets map[string]RequirementPreset) []string {
+	var res []string
+	for i, n1 := range requirements {
+		r1 := presets[n1]
+		for _, n2 := range requirements[i+1:] {
+			r2 := presets[n2]
+			for _, v1 := range r1.Volumes {
+				for _, v2 := range r2.Volumes {
+					if v1.Name == v2.Name && !reflect.DeepEqual(v1, v2) {
+						res = append(res, fmt.Sprintf("requirements %s and %s define the volume %s differently", n1, n2, v1.Name))
+					}
+				}
+			}
+			if !shareContainer(r1, r2) {
+				continue
 			}
+			for _, vm1 := range r1.VolumeMounts {
+				for _, vm2 := range r2.VolumeMounts {
+					if vm1.MountPath == vm2.MountPath && !reflect.DeepEqual(vm1, vm2) {
+						res = append(res, fmt.Sprintf("requirements %s and %s define the volume mount at %s differently", n1, n2, vm1.MountPath))
+					}
+				}
+			}
+			for _, e1 := range r1.Env {
+				for _, e2 := range r2.Env {
+					if e1.Name == e2.Name && !reflect.DeepEqual(e1, e2) {
+						res = append(res, fmt.Sprintf("requirements %s and %s define the env %s differently", n1, n2, e1.Name))
+					}
+				}
+			}
+		}
+	}
+	return res
+}
+
+// shareContainer returns whether the presets add their env and volume mounts to the same container.
+func shareContainer(r1, r2 RequirementPreset) bool {
+	targets := r1.Containers
+	if len(targets) == 0 {
+		targets = []string{TestContainerName}
+	}
+	for _, c := range targets {
+		if r2.targets(c) {
+			return true
 		}
 	}
+	return false
 }
@@ -0,0 +1,113 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestExpandRequirements(t *testing.T) {
+	presets := map[string]RequirementPreset{
+		"cache":  {},
+		"docker": {Requires: []string{"cache"}},
+		"kind":   {Requires: []string{"docker"}},
+		"a":      {Requires: []string{"b"}},
+		"b":      {Requires: []string{"a"}},
+		"broken": {Requires: []string{"missing"}},
+	}
+	testCases := []struct {
+		name         string
+		requirements []string
+		expected     []string
+		err          string
+	}{
+		{
+			name:         "required presets come first",
+			requirements: []string{"kind", "gcp"},
+			expected:     []string{"cache", "docker", "kind", "gcp"},
+		},
+		{
+			name:         "presets are only added once",
+			requirements: []string{"cache", "kind", "docker"},
+			expected:     []string{"cache", "docker", "kind"},
+		},
+		{
+			name:         "cycle",
+			requirements: []string{"a"},
+			err:          "requirements require each other in a cycle: a -> b -> a",
+		},
+		{
+			name:         "nonexistent required preset",
+			requirements: []string{"broken"},
+			err:          "requirement broken requires nonexistent requirement missing",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := expandRequirements(tc.requirements, presets)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tc.expected, actual) {
+				t.Errorf("requirements do not match; actual: %v\n expected %v\n", actual, tc.expected)
+			}
+		})
+	}
+}
+
+func TestRequirementConflicts(t *testing.T) {
+	dockerRoot := v1.Volume{Name: "docker-root", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}}
+	presets := map[string]RequirementPreset{
+		"docker": {
+			Volumes:      []v1.Volume{dockerRoot},
+			VolumeMounts: []v1.VolumeMount{{Name: "docker-root", MountPath: "/var/lib/docker"}},
+			Env:          []v1.EnvVar{{Name: "DOCKER_HOST", Value: "unix:///var/run/docker.sock"}},
+		},
+		"kind": {
+			Volumes:      []v1.Volume{dockerRoot},
+			VolumeMounts: []v1.VolumeMount{{Name: "docker-root", MountPath: "/var/lib/docker"}},
+		},
+		"dind": {
+			Volumes:      []v1.Volume{{Name: "docker-root", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/tmp"}}}},
+			VolumeMounts: []v1.VolumeMount{{Name: "docker-root", MountPath: "/var/lib/docker", ReadOnly: true}},
+			Env:          []v1.EnvVar{{Name: "DOCKER_HOST", Value: "tcp://localhost:2375"}},
+		},
+		"sidecar": {
+			Containers: []string{"dind"},
+			Env:        []v1.EnvVar{{Name: "DOCKER_HOST", Value: "tcp://localhost:2375"}},
+		},
+	}
+
+	if actual := requirementConflicts([]string{"docker", "kind", "sidecar"}, presets); len(actual) != 0 {
+		t.Errorf("unexpected conflicts: %v", actual)
+	}
+	expected := []string{
+		"requirements docker and dind define the volume docker-root differently",
+		"requirements docker and dind define the volume mount at /var/lib/docker differently",
+		"requirements docker and dind define the env DOCKER_HOST differently",
+	}
+	if actual := requirementConflicts([]string{"docker", "dind"}, presets); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("conflicts do not match; actual: %v\n expected %v\n", actual, expected)
+	}
+}
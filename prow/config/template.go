@@ -0,0 +1,87 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// resolveTemplates replaces the jobs extending a template with the template merged with the
+// job. The fields set by the job replace the ones of the template as a whole. The templates are
+// removed from the returned config, so that it can be written out again as a branched meta config.
+func resolveTemplates(jobsConfig JobsConfig) (JobsConfig, error) {
+	jobs := make([]Job, 0, len(jobsConfig.Jobs))
+	for _, job := range jobsConfig.Jobs {
+		if job.Extends == "" {
+			jobs = append(jobs, job)
+			continue
+		}
+		fields, err := resolveTemplate(job, jobsConfig.Templates, nil)
+		if err != nil {
+			if ve, ok := err.(*ValidationError); ok {
+				ve.Job = job.Name
+			}
+			return JobsConfig{}, err
+		}
+		resolved := Job{}
+		if err := convertFields(fields, &resolved); err != nil {
+			return JobsConfig{}, newValidationError("", job.Name, "extends", "failed to merge the template: %v", err)
+		}
+		jobs = append(jobs, resolved)
+	}
+	jobsConfig.Jobs = jobs
+	jobsConfig.Templates = nil
+	return jobsConfig, nil
+}
+
+// resolveTemplate returns the fields of the job merged with the ones of the templates it extends.
+// chain holds the templates extended so far, to detect cycles.
+func resolveTemplate(job Job, templates map[string]Job, chain []string) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	if err := convertFields(job, &fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "extends")
+	if job.Extends == "" {
+		return fields, nil
+	}
+
+	chain = append(chain, job.Extends)
+	if contains(chain[:len(chain)-1], job.Extends) {
+		return nil, newValidationError("", "", "extends", "templates extend each other in a cycle: %s", strings.Join(chain, " -> "))
+	}
+	template, ok := templates[job.Extends]
+	if !ok {
+		return nil, newValidationError("", "", "extends", "unknown template %q", job.Extends)
+	}
+	res, err := resolveTemplate(template, templates, chain)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range fields {
+		res[k] = v
+	}
+	return res, nil
+}
+
+// convertFields converts between a job and its fields by their json representation.
+func convertFields(in, out interface{}) error {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
@@ -0,0 +1,81 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResolveTemplates(t *testing.T) {
+	testCases := []struct {
+		name      string
+		templates map[string]Job
+		job       Job
+		expected  Job
+		err       string
+	}{
+		{
+			name:      "job fields override the template",
+			templates: map[string]Job{"kind": {Types: []string{TypePresubmit}, Command: []string{"a"}, Requirements: []string{"kind"}}},
+			job:       Job{Name: "test", Extends: "kind", Command: []string{"b"}},
+			expected:  Job{Name: "test", Types: []string{TypePresubmit}, Command: []string{"b"}, Requirements: []string{"kind"}},
+		},
+		{
+			name: "template extending another template",
+			templates: map[string]Job{
+				"base": {Image: "foo", Command: []string{"a"}},
+				"kind": {Extends: "base", Command: []string{"b"}},
+			},
+			job:      Job{Name: "test", Extends: "kind"},
+			expected: Job{Name: "test", Image: "foo", Command: []string{"b"}},
+		},
+		{
+			name:      "unknown template",
+			templates: map[string]Job{"kind": {Extends: "base"}},
+			job:       Job{Name: "test", Extends: "kind"},
+			err:       `job "test": extends: unknown template "base"`,
+		},
+		{
+			name: "cycle",
+			templates: map[string]Job{
+				"a": {Extends: "b"},
+				"b": {Extends: "a"},
+			},
+			job: Job{Name: "test", Extends: "a"},
+			err: `job "test": extends: templates extend each other in a cycle: a -> b -> a`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := resolveTemplates(JobsConfig{Templates: tc.templates, Jobs: []Job{tc.job}})
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual.Templates != nil {
+				t.Errorf("templates are not removed: %v", actual.Templates)
+			}
+			if !reflect.DeepEqual([]Job{tc.expected}, actual.Jobs) {
+				t.Errorf("jobs do not match; actual: %+v\n expected %+v\n", actual.Jobs, []Job{tc.expected})
+			}
+		})
+	}
+}
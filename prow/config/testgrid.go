@@ -0,0 +1,343 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/hashicorp/go-multierror"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/test-infra/prow/config"
+)
+
+// JobTestgridConfig configures the testgrid tabs of the jobs of a meta config, or of a single job.
+// The fields set overwrite the ones of the global TestgridConfig, then the ones of the meta config.
+type JobTestgridConfig struct {
+	// Enabled adds the jobs to testgrid, or opts them out if false.
+	Enabled *bool `json:"enabled,omitempty"`
+	// Dashboards are the dashboards the jobs are added to, instead of the
+	// <org>[_<branch>]_<repo>[_<type>] dashboard of their repo, branch and type.
+	Dashboards []string `json:"dashboards,omitempty"`
+	// TabName is the name of the tab of the job, the job name if not set. It can only be set for a
+	// job.
+	TabName     string `json:"tab_name,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	AlertEmail             string `json:"alert_email,omitempty"`
+	NumFailuresToAlert     string `json:"num_failures_to_alert,omitempty"`
+	AlertStaleResultsHours string `json:"alert_stale_results_hours,omitempty"`
+}
+
+// resolveTestgrid returns the testgrid settings of the job, from the global config, the meta
+// config and the job. The jobs are added to testgrid if the settings are enabled.
+func resolveTestgrid(global TestgridConfig, jobsConfig JobsConfig, job Job) JobTestgridConfig {
+	enabled := global.Enabled
+	res := JobTestgridConfig{
+		Enabled:                &enabled,
+		AlertEmail:             global.AlertEmail,
+		NumFailuresToAlert:     global.NumFailuresToAlert,
+		AlertStaleResultsHours: global.AlertStaleResultsHours,
+	}
+	for _, tg := range []*JobTestgridConfig{jobsConfig.Testgrid, job.Testgrid} {
+		if tg == nil {
+			continue
+		}
+		if tg.Enabled != nil {
+			res.Enabled = tg.Enabled
+		}
+		if len(tg.Dashboards) > 0 {
+			res.Dashboards = tg.Dashboards
+		}
+		if tg.TabName != "" {
+			res.TabName = tg.TabName
+		}
+		if tg.Description != "" {
+			res.Description = tg.Description
+		}
+		if tg.AlertEmail != "" {
+			res.AlertEmail = tg.AlertEmail
+		}
+		if tg.NumFailuresToAlert != "" {
+			res.NumFailuresToAlert = tg.NumFailuresToAlert
+		}
+		if tg.AlertStaleResultsHours != "" {
+			res.AlertStaleResultsHours = tg.AlertStaleResultsHours
+		}
+	}
+	return res
+}
+
+func (tg JobTestgridConfig) enabled() bool {
+	return tg.Enabled != nil && *tg.Enabled
+}
+
+// annotations returns the testgrid annotations of a job, added to defaultDashboard unless the
+// dashboards are set. The alerts are only set if alert is, as the presubmits fail for the changes
+// under test rather than for the state of the branch.
+func (tg JobTestgridConfig) annotations(defaultDashboard string, alert bool) map[string]string {
+	dashboards := defaultDashboard
+	if len(tg.Dashboards) > 0 {
+		dashboards = strings.Join(tg.Dashboards, ", ")
+	}
+	res := map[string]string{TestGridDashboard: dashboards}
+	if tg.TabName != "" {
+		res[TestGridTabName] = tg.TabName
+	}
+	if tg.Description != "" {
+		res[TestGridDescription] = tg.Description
+	}
+	if alert {
+		res[TestGridAlertEmail] = tg.AlertEmail
+		res[TestGridNumFailures] = tg.NumFailuresToAlert
+		if tg.AlertStaleResultsHours != "" {
+			res[TestGridAlertStaleResultsHours] = tg.AlertStaleResultsHours
+		}
+	}
+	return res
+}
+
+// validateTestgrid validates the testgrid settings of the meta config if job is empty, or of the
+// job.
+func validateTestgrid(fileName, job string, tg *JobTestgridConfig) error {
+	if tg == nil {
+		return nil
+	}
+	var err *multierror.Error
+	if job == "" && tg.TabName != "" {
+		err = multierror.Append(err, newValidationError(fileName, job, "testgrid", "tab_name can only be set for a job"))
+	}
+	for _, f := range []struct{ name, value string }{
+		{"num_failures_to_alert", tg.NumFailuresToAlert},
+		{"alert_stale_results_hours", tg.AlertStaleResultsHours},
+	} {
+		if f.value == "" {
+			continue
+		}
+		if n, e := strconv.Atoi(f.value); e != nil || n <= 0 {
+			err = multierror.Append(err, newValidationError(fileName, job, "testgrid", "%s %q must be a positive number", f.name, f.value))
+		}
+	}
+	return err.ErrorOrNil()
+}
+
+// TestgridConfiguration is a standalone TestGrid configuration, in the format of the TestGrid
+// config.yaml.
+type TestgridConfiguration struct {
+	TestGroups      []TestGroup      `json:"test_groups"`
+	Dashboards      []Dashboard      `json:"dashboards"`
+	DashboardGroups []DashboardGroup `json:"dashboard_groups"`
+}
+
+// TestGroup is the results of a job, read from its GCS logs.
+type TestGroup struct {
+	Name                   string `json:"name"`
+	GCSPrefix              string `json:"gcs_prefix"`
+	NumFailuresToAlert     int    `json:"num_failures_to_alert,omitempty"`
+	AlertStaleResultsHours int    `json:"alert_stale_results_hours,omitempty"`
+}
+
+// Dashboard is a page of tabs, each of them showing a test group.
+type Dashboard struct {
+	Name         string         `json:"name"`
+	DashboardTab []DashboardTab `json:"dashboard_tab,omitempty"`
+}
+
+type DashboardTab struct {
+	Name          string        `json:"name"`
+	TestGroupName string        `json:"test_group_name"`
+	Description   string        `json:"description,omitempty"`
+	AlertOptions  *AlertOptions `json:"alert_options,omitempty"`
+}
+
+type AlertOptions struct {
+	AlertMailToAddresses string `json:"alert_mail_to_addresses,omitempty"`
+}
+
+// DashboardGroup groups the dashboards of an org, or of an org and release branch.
+type DashboardGroup struct {
+	Name           string   `json:"name"`
+	DashboardNames []string `json:"dashboard_names"`
+}
+
+// GenerateTestgridConfig generates the TestGrid configuration of the jobs added to testgrid by the
+// meta configs, from the testgrid annotations of the generated jobs. The test groups read the logs
+// from the GCS bucket of the job, or the bucket of the global testgrid config. The dashboards are
+// grouped by org for the default branch and by org and branch for the other ones.
+func (cli *Client) GenerateTestgridConfig(metaConfigs []MetaConfig) (*TestgridConfiguration, error) {
+	g := &testgridGenerator{
+		bucket:     cli.GlobalConfig.TestgridConfig.GCSBucket,
+		dashboards: map[string]*Dashboard{},
+		groups:     map[string]sets.String{},
+		grouped:    sets.NewString(),
+		testGroups: sets.NewString(),
+	}
+	for _, mc := range metaConfigs {
+		jobs := mc.JobsConfig
+		for _, branch := range jobs.Branches {
+			jc, err := cli.ConvertJobConfig(jobs, branch)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", mc.Path, err)
+			}
+			group := jobs.Org
+			if branch != cli.defaultBranch(jobs) {
+				group += "_" + branch
+			}
+			for _, p := range jc.PresubmitsStatic[jobs.repoKey()] {
+				g.add(group, p.JobBase, "pr-logs/directory")
+			}
+			for _, p := range jc.PostsubmitsStatic[jobs.repoKey()] {
+				g.add(group, p.JobBase, "logs")
+			}
+			for _, p := range jc.Periodics {
+				g.add(group, p.JobBase, "logs")
+			}
+		}
+	}
+	return g.configuration()
+}
+
+type testgridGenerator struct {
+	bucket string
+	res    TestgridConfiguration
+	errs   *multierror.Error
+
+	dashboards map[string]*Dashboard
+	// groups holds the dashboards of each group, a dashboard is in the group of the first job added
+	// to it.
+	groups     map[string]sets.String
+	grouped    sets.String
+	testGroups sets.String
+}
+
+// add adds the test group of the job to its dashboards, logsDir being the directory of the logs of
+// the job type in the bucket.
+func (g *testgridGenerator) add(group string, job config.JobBase, logsDir string) {
+	if job.Annotations[TestGridDashboard] == "" {
+		return
+	}
+	bucket := g.bucket
+	if job.DecorationConfig != nil && job.DecorationConfig.GCSConfiguration != nil && job.DecorationConfig.GCSConfiguration.Bucket != "" {
+		bucket = job.DecorationConfig.GCSConfiguration.Bucket
+	}
+	if bucket == "" {
+		g.errs = multierror.Append(g.errs, fmt.Errorf("job %s: the GCS bucket of the logs is not set", job.Name))
+		return
+	}
+
+	// The same job is generated by the meta configs of multiple branches with a different name, so
+	// a duplicated test group is a duplicated job.
+	if g.testGroups.Has(job.Name) {
+		g.errs = multierror.Append(g.errs, fmt.Errorf("duplicated test group %s", job.Name))
+		return
+	}
+	g.testGroups.Insert(job.Name)
+	tg := TestGroup{
+		Name:      job.Name,
+		GCSPrefix: fmt.Sprintf("%s/%s/%s", bucket, logsDir, job.Name),
+	}
+	var err error
+	if tg.NumFailuresToAlert, err = annotationNumber(job, TestGridNumFailures); err != nil {
+		g.errs = multierror.Append(g.errs, err)
+	}
+	if tg.AlertStaleResultsHours, err = annotationNumber(job, TestGridAlertStaleResultsHours); err != nil {
+		g.errs = multierror.Append(g.errs, err)
+	}
+	g.res.TestGroups = append(g.res.TestGroups, tg)
+
+	tab := DashboardTab{
+		Name:          job.Name,
+		TestGroupName: job.Name,
+		Description:   job.Annotations[TestGridDescription],
+	}
+	if name := job.Annotations[TestGridTabName]; name != "" {
+		tab.Name = name
+	}
+	if email := job.Annotations[TestGridAlertEmail]; email != "" {
+		tab.AlertOptions = &AlertOptions{AlertMailToAddresses: email}
+	}
+	for _, name := range strings.Split(job.Annotations[TestGridDashboard], ",") {
+		name = strings.TrimSpace(name)
+		d, ok := g.dashboards[name]
+		if !ok {
+			d = &Dashboard{Name: name}
+			g.dashboards[name] = d
+		}
+		for _, t := range d.DashboardTab {
+			if t.Name == tab.Name {
+				g.errs = multierror.Append(g.errs, fmt.Errorf("dashboard %s: duplicated tab %s, for test groups %s and %s", name, tab.Name, t.TestGroupName, tab.TestGroupName))
+			}
+		}
+		d.DashboardTab = append(d.DashboardTab, tab)
+		if !g.grouped.Has(name) {
+			g.grouped.Insert(name)
+			if g.groups[group] == nil {
+				g.groups[group] = sets.NewString()
+			}
+			g.groups[group].Insert(name)
+		}
+	}
+}
+
+func annotationNumber(job config.JobBase, annotation string) (int, error) {
+	value := job.Annotations[annotation]
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("job %s: invalid %s annotation %q: %v", job.Name, annotation, value, err)
+	}
+	return n, nil
+}
+
+// configuration returns the configuration with all its entries sorted by name.
+func (g *testgridGenerator) configuration() (*TestgridConfiguration, error) {
+	if err := g.errs.ErrorOrNil(); err != nil {
+		return nil, err
+	}
+	res := g.res
+	sort.Slice(res.TestGroups, func(i, j int) bool {
+		return res.TestGroups[i].Name < res.TestGroups[j].Name
+	})
+	for _, name := range sets.StringKeySet(g.dashboards).List() {
+		d := *g.dashboards[name]
+		sort.Slice(d.DashboardTab, func(i, j int) bool {
+			return d.DashboardTab[i].Name < d.DashboardTab[j].Name
+		})
+		res.Dashboards = append(res.Dashboards, d)
+	}
+	for _, name := range sets.StringKeySet(g.groups).List() {
+		res.DashboardGroups = append(res.DashboardGroups, DashboardGroup{Name: name, DashboardNames: g.groups[name].List()})
+	}
+	return &res, nil
+}
+
+// Write writes the configuration as YAML.
+func (c *TestgridConfiguration) Write(w io.Writer, header string) error {
+	bs, err := yaml.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to marshal the testgrid config: %v", err)
+	}
+	if _, err := io.WriteString(w, header); err != nil {
+		return err
+	}
+	_, err = w.Write(bs)
+	return err
+}
@@ -0,0 +1,161 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testgridMetaConfigs() []MetaConfig {
+	no := false
+	return []MetaConfig{
+		{Path: "istio.yaml", JobsConfig: JobsConfig{
+			Org:      "istio",
+			Repo:     "istio",
+			Branches: []string{"master", "release-1.11"},
+			Image:    "foo",
+			Testgrid: &JobTestgridConfig{AlertStaleResultsHours: "24"},
+			Jobs: []Job{
+				{Name: "unit", Testgrid: &JobTestgridConfig{TabName: "unit-tests", Description: "The unit tests."}},
+				{Name: "lint", Types: []string{TypePresubmit}, Testgrid: &JobTestgridConfig{Enabled: &no}},
+				{Name: "nightly", Types: []string{TypePeriodic}, Cron: "0 0 * * *",
+					Testgrid: &JobTestgridConfig{Dashboards: []string{"istio_nightly"}, TabName: "nightly", AlertEmail: "nightly@istio.io", NumFailuresToAlert: "3"}},
+			},
+		}},
+	}
+}
+
+func TestTestgridAnnotations(t *testing.T) {
+	cli := &Client{GlobalConfig: GlobalConfig{TestgridConfig: TestgridConfig{
+		Enabled: true, AlertEmail: "oncall@istio.io", NumFailuresToAlert: "1",
+	}}}
+	output, err := cli.GenerateJobConfigs(testgridMetaConfigs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual := map[string]map[string]string{}
+	for _, jc := range output {
+		for _, p := range jc.PresubmitsStatic["istio/istio"] {
+			actual[p.Name] = testgridAnnotations(p.Annotations)
+		}
+		for _, p := range jc.PostsubmitsStatic["istio/istio"] {
+			actual[p.Name] = testgridAnnotations(p.Annotations)
+		}
+		for _, p := range jc.Periodics {
+			actual[p.Name] = testgridAnnotations(p.Annotations)
+		}
+	}
+	expected := map[string]map[string]string{
+		"unit_istio": {
+			TestGridDashboard: "istio_istio", TestGridTabName: "unit-tests", TestGridDescription: "The unit tests.",
+		},
+		"unit_istio_postsubmit": {
+			TestGridDashboard: "istio_istio_postsubmit", TestGridTabName: "unit-tests", TestGridDescription: "The unit tests.",
+			TestGridAlertEmail: "oncall@istio.io", TestGridNumFailures: "1", TestGridAlertStaleResultsHours: "24",
+		},
+		"unit_istio_release-1.11": {
+			TestGridDashboard: "istio_release-1.11_istio", TestGridTabName: "unit-tests", TestGridDescription: "The unit tests.",
+		},
+		"unit_istio_release-1.11_postsubmit": {
+			TestGridDashboard: "istio_release-1.11_istio_postsubmit", TestGridTabName: "unit-tests", TestGridDescription: "The unit tests.",
+			TestGridAlertEmail: "oncall@istio.io", TestGridNumFailures: "1", TestGridAlertStaleResultsHours: "24",
+		},
+		"lint_istio":              {},
+		"lint_istio_release-1.11": {},
+		"nightly_istio_periodic": {
+			TestGridDashboard: "istio_nightly", TestGridTabName: "nightly", TestGridAlertEmail: "nightly@istio.io", TestGridNumFailures: "3", TestGridAlertStaleResultsHours: "24",
+		},
+		"nightly_istio_release-1.11_periodic": {
+			TestGridDashboard: "istio_nightly", TestGridTabName: "nightly", TestGridAlertEmail: "nightly@istio.io", TestGridNumFailures: "3", TestGridAlertStaleResultsHours: "24",
+		},
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("testgrid annotations do not match; actual: %v\n expected %v\n", actual, expected)
+	}
+}
+
+func testgridAnnotations(annotations map[string]string) map[string]string {
+	res := map[string]string{}
+	for k, v := range annotations {
+		if strings.HasPrefix(k, "testgrid-") || k == TestGridDescription {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+func TestGenerateTestgridConfig(t *testing.T) {
+	cli := &Client{GlobalConfig: GlobalConfig{TestgridConfig: TestgridConfig{
+		Enabled: true, AlertEmail: "oncall@istio.io", NumFailuresToAlert: "1", GCSBucket: "istio-prow",
+	}}}
+	metaConfigs := testgridMetaConfigs()
+	metaConfigs[0].JobsConfig.Branches = []string{"master"}
+	tg, err := cli.GenerateTestgridConfig(metaConfigs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actual bytes.Buffer
+	if err := tg.Write(&actual, ""); err != nil {
+		t.Fatal(err)
+	}
+	const expected = `dashboard_groups:
+- dashboard_names:
+  - istio_istio
+  - istio_istio_postsubmit
+  - istio_nightly
+  name: istio
+dashboards:
+- dashboard_tab:
+  - description: The unit tests.
+    name: unit-tests
+    test_group_name: unit_istio
+  name: istio_istio
+- dashboard_tab:
+  - alert_options:
+      alert_mail_to_addresses: oncall@istio.io
+    description: The unit tests.
+    name: unit-tests
+    test_group_name: unit_istio_postsubmit
+  name: istio_istio_postsubmit
+- dashboard_tab:
+  - alert_options:
+      alert_mail_to_addresses: nightly@istio.io
+    name: nightly
+    test_group_name: nightly_istio_periodic
+  name: istio_nightly
+test_groups:
+- alert_stale_results_hours: 24
+  gcs_prefix: istio-prow/logs/nightly_istio_periodic
+  name: nightly_istio_periodic
+  num_failures_to_alert: 3
+- gcs_prefix: istio-prow/pr-logs/directory/unit_istio
+  name: unit_istio
+- alert_stale_results_hours: 24
+  gcs_prefix: istio-prow/logs/unit_istio_postsubmit
+  name: unit_istio_postsubmit
+  num_failures_to_alert: 1
+`
+	if actual.String() != expected {
+		t.Errorf("testgrid config does not match; actual:\n%s\nexpected:\n%s", actual.String(), expected)
+	}
+
+	// The nightly jobs of both branches have the same tab in the same dashboard.
+	if _, err := cli.GenerateTestgridConfig(testgridMetaConfigs()); err == nil || !strings.Contains(err.Error(), "duplicated tab nightly,") {
+		t.Errorf("expected a duplicated tab error, got %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"github.com/hashicorp/go-multierror"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/test-infra/prow/config"
+)
+
+// TriggerModeManual makes the presubmit of a job run only when it is triggered by its trigger
+// comment, `/test <job name>` by default, and never for the changes of a pull request.
+const TriggerModeManual = "manual"
+
+// triggerModeLabel is rejected with an explicit error: Prow neither triggers presubmits on the
+// labels of a pull request nor supports run_before_merge, so the presubmits cannot be gated on
+// labels. Such jobs use TriggerModeManual and are triggered once the pull request is labeled.
+const triggerModeLabel = "label"
+
+// applyTriggerMode makes the presubmit only run when triggered by its comment for the manual
+// trigger mode.
+func applyTriggerMode(presubmit *config.Presubmit, job Job) {
+	if job.TriggerMode != TriggerModeManual {
+		return
+	}
+	presubmit.AlwaysRun = false
+	presubmit.RegexpChangeMatcher = config.RegexpChangeMatcher{}
+}
+
+func validateTriggerMode(fileName string, job Job) error {
+	if job.TriggerMode == "" {
+		return nil
+	}
+	if job.TriggerMode == triggerModeLabel {
+		return newValidationError(fileName, job.Name, "trigger_mode",
+			"trigger_mode %s is not supported as Prow cannot trigger presubmits on labels, use trigger_mode %s instead", triggerModeLabel, TriggerModeManual)
+	}
+	if e := validate(job.TriggerMode, []string{TriggerModeManual}, "trigger_mode"); e != nil {
+		return newValidationError(fileName, job.Name, "trigger_mode", "%v", e)
+	}
+	var err *multierror.Error
+	if len(job.Types) > 0 && !sets.NewString(job.Types...).Has(TypePresubmit) {
+		err = multierror.Append(err, newValidationError(fileName, job.Name, "trigger_mode",
+			"trigger_mode %s only applies to presubmits", job.TriggerMode))
+	}
+	if sets.NewString(job.Modifiers...).Has(ModifierSkipped) {
+		err = multierror.Append(err, newValidationError(fileName, job.Name, "trigger_mode",
+			"trigger_mode %s cannot be combined with the %s modifier", job.TriggerMode, ModifierSkipped))
+	}
+	if job.Regex != "" || len(job.RunIfChangedPaths) > 0 || len(job.SkipIfOnlyChangedPaths) > 0 {
+		err = multierror.Append(err, newValidationError(fileName, job.Name, "trigger_mode",
+			"trigger_mode %s cannot be combined with regex, run_if_changed_paths or skip_if_only_changed_paths", job.TriggerMode))
+	}
+	return err.ErrorOrNil()
+}
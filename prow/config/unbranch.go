@@ -0,0 +1,198 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"istio.io/test-infra/prow/genjobs/pkg/configuration"
+)
+
+// UnbranchOptions configures the files a release branch is removed from.
+type UnbranchOptions struct {
+	// Version is the release version, e.g. 1.7 for the release-1.7 branch.
+	Version string
+	// OutputDir is the directory of the generated job configs, including the private ones.
+	OutputDir string
+	// TransformConfigDir is the directory of the private transform configs. They are not removed
+	// if it is empty.
+	TransformConfigDir string
+	// ProwConfig is the Prow config file the branch protection is removed from. The branch
+	// protection is not changed if it is empty.
+	ProwConfig string
+}
+
+// UnbranchPlan lists the changes removing a release branch.
+type UnbranchPlan struct {
+	Version string
+	Branch  string
+	// MetaConfigs are the meta config files only configuring the branch.
+	MetaConfigs []string
+	// TransformConfigs are the private transform config files only configuring the branch.
+	TransformConfigs []string
+	// Generated are the job config files generated for the branch.
+	Generated []string
+	// ProwConfig is the Prow config file the branch protection is removed from, with its new
+	// content. It is empty if the branch is not protected.
+	ProwConfig        string
+	ProwConfigContent []byte
+}
+
+// PlanUnbranch returns the changes removing the release branch of the options, i.e. the files
+// created by the branch command for it. The meta configs and transform configs are removed if the
+// branch is the only one they configure, e.g. istio-1.7.yaml, and the generated files are the ones
+// of the branch, public or private. The branch protection of the branch is removed as well.
+func (cli *Client) PlanUnbranch(o UnbranchOptions, metaConfigs []MetaConfig) (*UnbranchPlan, error) {
+	if !versionRegex.MatchString(o.Version) {
+		return nil, fmt.Errorf("invalid release version %q, must be of the form <major>.<minor>", o.Version)
+	}
+	p := &UnbranchPlan{Version: o.Version, Branch: "release-" + o.Version}
+
+	for _, mc := range metaConfigs {
+		if onlyBranch(mc.JobsConfig.Branches, p.Branch) {
+			p.MetaConfigs = append(p.MetaConfigs, mc.Path)
+		}
+	}
+
+	if o.TransformConfigDir != "" {
+		err := filepath.Walk(o.TransformConfigDir, func(src string, file os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if file.IsDir() || !IsMetaConfigFile(file.Name()) {
+				return nil
+			}
+			c, err := configuration.ReadTransformJobsConfig(src)
+			if err != nil {
+				return err
+			}
+			if onlyBranch(c.Defaults.Branches, p.Branch) {
+				p.TransformConfigs = append(p.TransformConfigs, src)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("walking through the transform config files failed: %v", err)
+		}
+	}
+
+	if o.OutputDir != "" {
+		err := filepath.Walk(o.OutputDir, func(src string, file os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !file.IsDir() && strings.HasSuffix(file.Name(), "."+p.Branch+".gen.yaml") {
+				p.Generated = append(p.Generated, src)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("walking through the generated files failed: %v", err)
+		}
+	}
+
+	if o.ProwConfig != "" {
+		content, err := ioutil.ReadFile(o.ProwConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", o.ProwConfig, err)
+		}
+		newContent, err := removeBranchProtection(string(content), o.Version)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", o.ProwConfig, err)
+		}
+		if newContent != string(content) {
+			p.ProwConfig = o.ProwConfig
+			p.ProwConfigContent = []byte(newContent)
+		}
+	}
+
+	if len(p.MetaConfigs) == 0 && len(p.TransformConfigs) == 0 && len(p.Generated) == 0 && p.ProwConfig == "" {
+		return nil, fmt.Errorf("nothing was created for the %s branch", p.Branch)
+	}
+	return p, nil
+}
+
+// Apply removes the files of the branch and its branch protection.
+func (p *UnbranchPlan) Apply() error {
+	for _, files := range [][]string{p.MetaConfigs, p.TransformConfigs, p.Generated} {
+		for _, f := range files {
+			if err := os.Remove(f); err != nil {
+				return fmt.Errorf("failed to remove %s: %v", f, err)
+			}
+		}
+	}
+	if p.ProwConfig != "" {
+		if err := ioutil.WriteFile(p.ProwConfig, p.ProwConfigContent, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %v", p.ProwConfig, err)
+		}
+	}
+	return nil
+}
+
+// Write writes the plan in a human readable form.
+func (p *UnbranchPlan) Write(w io.Writer) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Removing the %s branch:\n", p.Branch)
+	for _, f := range p.MetaConfigs {
+		fmt.Fprintf(&sb, "- remove meta config %s\n", f)
+	}
+	for _, f := range p.TransformConfigs {
+		fmt.Fprintf(&sb, "- remove transform config %s\n", f)
+	}
+	for _, f := range p.Generated {
+		fmt.Fprintf(&sb, "- remove generated file %s\n", f)
+	}
+	if p.ProwConfig != "" {
+		fmt.Fprintf(&sb, "- remove the branch protection of %s from %s\n", p.Branch, p.ProwConfig)
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func onlyBranch(branches []string, branch string) bool {
+	return len(branches) == 1 && branches[0] == branch
+}
+
+// removeBranchProtection removes the entries of the release branch of the version from the
+// branch-protection section of the Prow config, keeping the rest of the config as is.
+func removeBranchProtection(content, version string) (string, error) {
+	lines := strings.Split(content, "\n")
+	start, end := protectionSection(lines)
+	if start < 0 {
+		return "", fmt.Errorf("no branch-protection section")
+	}
+
+	branchRegex := regexp.MustCompile(`^\s*release-` + regexp.QuoteMeta(version) + `:`)
+	res := append([]string{}, lines[:start]...)
+	for i := start; i < end; i++ {
+		if !branchRegex.MatchString(lines[i]) {
+			res = append(res, lines[i])
+			continue
+		}
+		// The entry lasts until the next line indented as much as it, or less.
+		indent := countIndent(lines[i])
+		for i+1 < end && strings.TrimSpace(lines[i+1]) != "" && countIndent(lines[i+1]) > indent {
+			i++
+		}
+	}
+	res = append(res, lines[end:]...)
+	return strings.Join(res, "\n"), nil
+}
@@ -0,0 +1,127 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestUnbranch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unbranch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	write("jobs/istio.yaml", `org: istio
+repo: istio
+support_release_branching: true
+jobs:
+- name: unit-tests
+  command: [make, test]
+`)
+	branchedMeta := write("jobs/istio-1.11.yaml", `org: istio
+repo: istio
+branches: [release-1.11]
+jobs:
+- name: unit-tests
+  command: [make, test]
+`)
+	write("jobs/bots.yaml", `org: istio
+repo: bots
+branches: [master, release-1.11]
+jobs:
+- name: unit-tests
+  command: [make, test]
+`)
+	write("private/istio.yaml", `org: istio
+repo: istio
+support_release_branching: true
+defaults:
+  branches: [master]
+`)
+	branchedTransform := write("private/istio-1.11.yaml", `org: istio
+repo: istio
+defaults:
+  branches: [release-1.11]
+`)
+	write("output/istio/istio/istio.istio.master.gen.yaml", "")
+	generated := write("output/istio/istio/istio.istio.release-1.11.gen.yaml", "")
+	privateGenerated := write("output/istio-private/istio/istio-private.istio.release-1.11.gen.yaml", "")
+	prowConfig := write("config.yaml", branchedProwConfig)
+
+	cli := &Client{}
+	metaConfigs, err := cli.ReadJobsConfigs(filepath.Join(dir, "jobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := cli.PlanUnbranch(UnbranchOptions{
+		Version:            "1.11",
+		OutputDir:          filepath.Join(dir, "output"),
+		TransformConfigDir: filepath.Join(dir, "private"),
+		ProwConfig:         prowConfig,
+	}, metaConfigs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &UnbranchPlan{
+		Version:           "1.11",
+		Branch:            "release-1.11",
+		MetaConfigs:       []string{branchedMeta},
+		TransformConfigs:  []string{branchedTransform},
+		Generated:         []string{generated, privateGenerated},
+		ProwConfig:        prowConfig,
+		ProwConfigContent: []byte(branchProwConfig),
+	}
+	if !reflect.DeepEqual(expected, plan) {
+		t.Fatalf("plan does not match; actual: %+v\n expected %+v\n", plan, expected)
+	}
+	if _, err := os.Stat(branchedMeta); err != nil {
+		t.Fatalf("the plan must not remove the files, got %v", err)
+	}
+
+	if err := plan.Apply(); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{branchedMeta, branchedTransform, generated, privateGenerated} {
+		if _, err := os.Stat(f); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed, got %v", f, err)
+		}
+	}
+	content, err := ioutil.ReadFile(prowConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != branchProwConfig {
+		t.Errorf("branch protection does not match; actual:\n%s\nexpected:\n%s", content, branchProwConfig)
+	}
+
+	if _, err := cli.PlanUnbranch(UnbranchOptions{Version: "1.12", OutputDir: filepath.Join(dir, "output")}, metaConfigs); err == nil {
+		t.Error("expected an error for a branch that was not created")
+	}
+}
@@ -21,7 +21,6 @@ import (
 	"os"
 	"path"
 	"path/filepath"
-	"strings"
 
 	"istio.io/test-infra/prow/genjobs/pkg/configuration"
 )
@@ -37,21 +36,6 @@ func exit(err error, context string) {
 
 var inputDir = flag.String("input-dir", "../config/istio-private_jobs", "directory of input jobs")
 
-// branchJobSlices updates transform jobs slices such as allow and deny jobs using a branch name
-func branchJobSlices(in []string, branch string) []string {
-	for key, val := range in {
-		if strings.HasSuffix(val, "_postsubmit") {
-			val = strings.Replace(val, "_postsubmit", fmt.Sprintf("_%s_postsubmit", branch), 1)
-		} else if strings.HasSuffix(val, "_presubmit") {
-			val = strings.Replace(val, "_presubmit", fmt.Sprintf("_%s_presubmit", branch), 1)
-		} else {
-			val = fmt.Sprintf("%s_%s", val, branch)
-		}
-		in[key] = val
-	}
-	return in
-}
-
 // Note that this app mirrors the functionality of prow/cmd/generate.go, but acting on transformations instead of prow jobs.
 // Any changes made here should also be considered for prow/cmd/generate.go.
 func main() {
@@ -81,24 +65,12 @@ func main() {
 				log.Println("skipping", file.Name())
 				return nil
 			}
-			jobs := configuration.ReadTransformJobsConfig(src)
+			jobs, err := configuration.ReadTransformJobsConfig(src)
+			if err != nil {
+				exit(err, "reading the private meta config failed")
+			}
 			if jobs.SupportReleaseBranching {
-				branch := "release-" + flag.Arg(1)
-				jobs.Defaults.Branches = []string{branch}
-				jobs.SupportReleaseBranching = false
-				jobs.Defaults.Modifier = strings.Replace(jobs.Defaults.Modifier, "master_", fmt.Sprintf("%s_", branch), 1)
-
-				for key, transform := range jobs.Transforms {
-					transform.JobAllowlist = branchJobSlices(transform.JobAllowlist, branch)
-					transform.JobDenylist = branchJobSlices(transform.JobDenylist, branch)
-
-					for key, val := range transform.Labels {
-						transform.Labels[key] = strings.Replace(val, "master", branch, 1)
-					}
-
-					jobs.Transforms[key] = transform
-
-				}
+				jobs = configuration.BranchTransformJobsConfig(jobs, flag.Arg(1))
 				name := file.Name()
 				ext := filepath.Ext(name)
 				name = name[:len(name)-len(ext)] + "-" + flag.Arg(1) + ext
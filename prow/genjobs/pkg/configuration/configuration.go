@@ -19,11 +19,10 @@ package configuration
 import (
 	"fmt"
 	"io/ioutil"
+	"strings"
 
 	"github.com/ghodss/yaml"
 	prowjob "k8s.io/test-infra/prow/apis/prowjobs/v1"
-
-	"istio.io/test-infra/prow/genjobs/pkg/util"
 )
 
 // Configuration is the yaml configuration file format.
@@ -78,18 +77,18 @@ type Transform struct {
 }
 
 // ReadTransformJobsConfig reads the private jobs yaml
-func ReadTransformJobsConfig(file string) Configuration {
+func ReadTransformJobsConfig(file string) (Configuration, error) {
 	yamlFile, err := ioutil.ReadFile(file)
 	if err != nil {
-		util.PrintErrAndExit(fmt.Errorf("failed to read %s", file))
+		return Configuration{}, fmt.Errorf("failed to read %s: %v", file, err)
 	}
 
 	jobsConfig := Configuration{}
 	if err := yaml.Unmarshal(yamlFile, &jobsConfig); err != nil {
-		util.PrintErrAndExit(fmt.Errorf("failed to unmarshal %s", file))
+		return Configuration{}, fmt.Errorf("failed to unmarshal %s: %v", file, err)
 	}
 
-	return jobsConfig
+	return jobsConfig, nil
 }
 
 // WriteTransformJobConfig writes the job yaml
@@ -101,3 +100,48 @@ func WriteTransformJobConfig(jobsConfig Configuration, file string) error {
 
 	return ioutil.WriteFile(file, bytes, 0644)
 }
+
+// BranchTransformJobsConfig returns the configuration of the release-<version> branch for a
+// configuration supporting release branching. The job names and labels referring to master are
+// updated for the branch.
+func BranchTransformJobsConfig(jobsConfig Configuration, version string) Configuration {
+	branch := "release-" + version
+	jobsConfig.Defaults.Branches = []string{branch}
+	jobsConfig.SupportReleaseBranching = false
+	jobsConfig.Defaults.Modifier = strings.Replace(jobsConfig.Defaults.Modifier, "master_", fmt.Sprintf("%s_", branch), 1)
+
+	transforms := make([]Transform, 0, len(jobsConfig.Transforms))
+	for _, transform := range jobsConfig.Transforms {
+		transform.JobAllowlist = BranchJobSlices(transform.JobAllowlist, branch)
+		transform.JobDenylist = BranchJobSlices(transform.JobDenylist, branch)
+
+		labels := make(map[string]string, len(transform.Labels))
+		for key, val := range transform.Labels {
+			labels[key] = strings.Replace(val, "master", branch, 1)
+		}
+		if transform.Labels != nil {
+			transform.Labels = labels
+		}
+		transforms = append(transforms, transform)
+	}
+	if jobsConfig.Transforms != nil {
+		jobsConfig.Transforms = transforms
+	}
+	return jobsConfig
+}
+
+// BranchJobSlices returns the transform jobs slices such as allow and deny jobs for a branch name.
+func BranchJobSlices(in []string, branch string) []string {
+	var res []string
+	for _, val := range in {
+		if strings.HasSuffix(val, "_postsubmit") {
+			val = strings.Replace(val, "_postsubmit", fmt.Sprintf("_%s_postsubmit", branch), 1)
+		} else if strings.HasSuffix(val, "_presubmit") {
+			val = strings.Replace(val, "_presubmit", fmt.Sprintf("_%s_presubmit", branch), 1)
+		} else {
+			val = fmt.Sprintf("%s_%s", val, branch)
+		}
+		res = append(res, val)
+	}
+	return res
+}
@@ -14,9 +14,12 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-package main
+package configuration
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 )
@@ -52,7 +55,7 @@ func TestBranchJobSlices(t *testing.T) {
 
 	for _, test := range testInstances {
 		t.Run(test.Name, func(t *testing.T) {
-			result := branchJobSlices(test.Values, test.BranchName)
+			result := BranchJobSlices(test.Values, test.BranchName)
 			if !reflect.DeepEqual(result, test.Out) {
 				t.Logf("Test \"%s\" failed: \n\t%+v \n\t\t not equal to \n\t%v", test.Name, result, test.Out)
 				t.Fail()
@@ -60,3 +63,28 @@ func TestBranchJobSlices(t *testing.T) {
 		})
 	}
 }
+
+func TestReadTransformJobsConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configuration")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	valid := filepath.Join(dir, "valid.yaml")
+	invalid := filepath.Join(dir, "invalid.yaml")
+	if err := ioutil.WriteFile(valid, []byte("org: istio\nrepo: istio\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(invalid, []byte("org: [istio"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if c, err := ReadTransformJobsConfig(valid); err != nil || c.Org != "istio" || c.Repo != "istio" {
+		t.Errorf("unexpected config %+v, %v", c, err)
+	}
+	for _, f := range []string{invalid, filepath.Join(dir, "missing.yaml")} {
+		if _, err := ReadTransformJobsConfig(f); err == nil {
+			t.Errorf("expected an error for %s", f)
+		}
+	}
+}